@@ -0,0 +1,149 @@
+package greenleeks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Adopt publishes the existing repository in dir the way Run publishes a
+// new one: it creates a repository with WithProvider, adds it as origin
+// and pushes all branches and tags. A repository that has a remote
+// already is left alone with ErrHasRemote.
+func (i *Initializer) Adopt(ctx context.Context, dir string) (remote *RemoteRepository, err error) {
+	ctx, span := tracer.Start(ctx, "greenleeks.Adopt", trace.WithAttributes(attribute.String("greenleeks.dir", dir)))
+	defer func() { endSpan(span, err) }()
+
+	if i.provider == nil {
+		return nil, errors.New("adopting a repository needs a provider")
+	}
+
+	fs, err := i.filesystem(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+
+	isUnderGit, err := isUnderGitControl(fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if directory is under git control: %w", err)
+	}
+	if !isUnderGit {
+		return nil, fmt.Errorf("%s is not a git repository", dir)
+	}
+
+	repo, err := openNested(fs, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remotes: %w", err)
+	}
+	if len(remotes) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrHasRemote, remotes[0].Config().Name)
+	}
+
+	if _, err := repo.Head(); err != nil {
+		return nil, fmt.Errorf("nothing to push, %s has no commits", dir)
+	}
+
+	remote, err = i.publish(ctx, repo, dir, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish: %w", err)
+	}
+
+	i.logger.Info("Adopted repository.", "dir", dir, "url", remote.CloneURL)
+	return remote, nil
+}
+
+// runAdopt publishes the given directory, or --root, if it is a
+// repository without remotes, and otherwise each such repository among its
+// subdirectories. Hidden directories are skipped.
+func runAdopt() error {
+	parent := opts.RootDir
+	switch len(opts.args) {
+	case 0:
+	case 1:
+		parent = opts.args[0]
+	default:
+		return fmt.Errorf("adopt takes at most one directory, got %d", len(opts.args))
+	}
+
+	if opts.Provider == "" {
+		return errors.New("adopt needs --provider")
+	}
+
+	options, err := cliOptions()
+	if err != nil {
+		return err
+	}
+	i := New(options...)
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	isUnderGit, err := IsUnderGitControl(parent)
+	if err != nil {
+		return err
+	}
+	if isUnderGit {
+		remote, err := i.Adopt(ctx, parent)
+		if err != nil {
+			return err
+		}
+		printAdopted(parent, remote)
+		return nil
+	}
+
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		dir := filepath.Join(parent, entry.Name())
+		isUnderGit, err := IsUnderGitControl(dir)
+		if err != nil || !isUnderGit {
+			continue
+		}
+
+		remote, err := i.Adopt(ctx, dir)
+		switch {
+		case errors.Is(err, ErrHasRemote):
+			slog.Debug("skipping repository with a remote", "dir", dir)
+		case err != nil:
+			slog.Error("failed to adopt repository", "dir", dir, "error", err)
+			failed++
+		default:
+			printAdopted(dir, remote)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to adopt %d repositories", failed)
+	}
+	return nil
+}
+
+func printAdopted(dir string, remote *RemoteRepository) {
+	if !opts.Quiet {
+		printStatus(os.Stdout, "adopted", dir+"  "+remote.CloneURL)
+	}
+}
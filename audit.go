@@ -0,0 +1,263 @@
+package greenleeks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// auditMaxSize is the size above which Audit checks the name of a file
+// but not its content.
+const auditMaxSize = 1 << 20
+
+// sensitiveNames are the base names, as path.Match patterns, of files
+// that hold credentials more often than not.
+var sensitiveNames = map[string]string{
+	".env":                  "dotenv file",
+	".env.*":                "dotenv file",
+	".netrc":                "netrc credentials",
+	".pgpass":               "postgres password file",
+	".git-credentials":      "git credentials",
+	".npmrc":                "npm config, which can hold a token",
+	".pypirc":               "pypi config, which can hold a token",
+	"id_rsa":                "ssh private key",
+	"id_dsa":                "ssh private key",
+	"id_ecdsa":              "ssh private key",
+	"id_ed25519":            "ssh private key",
+	"*.pem":                 "key or certificate file",
+	"*.key":                 "private key file",
+	"*.p12":                 "pkcs12 keystore",
+	"*.pfx":                 "pkcs12 keystore",
+	"*.jks":                 "java keystore",
+	"*.kdbx":                "keepass database",
+	"*.tfstate":             "terraform state",
+	"credentials.json":      "credentials file",
+	"service-account*.json": "cloud service account key",
+}
+
+// secretPatterns match secrets in the content of text files.
+var secretPatterns = []struct {
+	rule string
+	re   *regexp.Regexp
+}{
+	{"private key", regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{"aws access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{"gitlab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20}\b`)},
+	{"slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"google api key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"stripe key", regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"credentials in url", regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s:@]+:[^/\s:@]+@`)},
+}
+
+// Finding is a secret or sensitive file Audit found.
+type Finding struct {
+	Path string `json:"path"`
+	// Line is where in the file the secret is, or 0 for a file found by
+	// its name.
+	Line int    `json:"line,omitempty"`
+	Rule string `json:"rule"`
+	// Match is the start of what matched, the rest masked.
+	Match string `json:"match,omitempty"`
+}
+
+// AuditReport is what Audit found in the tree of one commit.
+type AuditReport struct {
+	Dir      string    `json:"dir"`
+	Commit   string    `json:"commit"`
+	Findings []Finding `json:"findings"`
+}
+
+// Audit checks the tree of the commit Run made in dir, or of the first
+// commit when the repository was made some other way, for files that
+// look sensitive by their name and for secrets in the text files.
+func (i *Initializer) Audit(ctx context.Context, dir string) (*AuditReport, error) {
+	fs, err := i.filesystem(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+
+	isUnderGit, err := isUnderGitControl(fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if directory is under git control: %w", err)
+	}
+	if !isUnderGit {
+		return nil, fmt.Errorf("%s is not a git repository", dir)
+	}
+
+	repo, err := openNested(fs, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	commit, err := auditedCommit(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the initial commit: %w", err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree: %w", err)
+	}
+
+	report := &AuditReport{Dir: dir, Commit: commit.Hash.String(), Findings: []Finding{}}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if f.Mode != filemode.Regular && f.Mode != filemode.Executable {
+			return nil
+		}
+
+		if rule := sensitiveName(f.Name); rule != "" {
+			report.Findings = append(report.Findings, Finding{Path: f.Name, Rule: rule})
+		}
+		if f.Size > auditMaxSize {
+			return nil
+		}
+
+		found, err := scanSecrets(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", f.Name, err)
+		}
+		report.Findings = append(report.Findings, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	i.logger.Info("Audited repository.", "dir", dir, "commit", commit.Hash.String()[:7], "findings", len(report.Findings))
+	return report, nil
+}
+
+// auditedCommit returns the commit recorded by recordCreation, or else
+// the root commit HEAD descends from along first parents.
+func auditedCommit(repo *git.Repository) (*object.Commit, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	if hash := cfg.Raw.Section(markerSection).Option("commit"); hash != "" {
+		return repo.CommitObject(plumbing.NewHash(hash))
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	for commit.NumParents() > 0 {
+		commit, err = commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return commit, nil
+}
+
+func sensitiveName(name string) string {
+	base := path.Base(name)
+	for pattern, rule := range sensitiveNames {
+		if ok, _ := path.Match(pattern, base); ok {
+			return rule
+		}
+	}
+	return ""
+}
+
+// scanSecrets returns the secretPatterns matches in f, which is skipped
+// if it is binary.
+func scanSecrets(f *object.File) ([]Finding, error) {
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(content[:min(len(content), binarySniffLen)]) {
+		return nil, nil
+	}
+
+	var found []Finding
+	lines := bufio.NewScanner(bytes.NewReader(content))
+	lines.Buffer(nil, auditMaxSize)
+	for n := 1; lines.Scan(); n++ {
+		for _, p := range secretPatterns {
+			if m := p.re.Find(lines.Bytes()); m != nil {
+				found = append(found, Finding{Path: f.Name, Line: n, Rule: p.rule, Match: mask(string(m))})
+			}
+		}
+	}
+	return found, lines.Err()
+}
+
+// mask keeps enough of a secret to tell which one it is.
+func mask(s string) string {
+	keep := min(len(s)/4, 8)
+	return s[:keep] + strings.Repeat("*", len(s)-keep)
+}
+
+// runAudit audits the repository in the given directory, or in --root,
+// and fails if anything was found, so that it can gate a pipeline.
+func runAudit() error {
+	dir := opts.RootDir
+	switch len(opts.args) {
+	case 0:
+	case 1:
+		dir = opts.args[0]
+	default:
+		return fmt.Errorf("audit takes at most one directory, got %d", len(opts.args))
+	}
+
+	options, err := cliOptions()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	report, err := New(options...).Audit(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	if opts.LogFormat == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range report.Findings {
+			location := f.Path
+			if f.Line > 0 {
+				location = fmt.Sprintf("%s:%d", f.Path, f.Line)
+			}
+			fmt.Println(strings.TrimSpace(fmt.Sprintf("%s  %s  %s", location, paint(colorRed, f.Rule), f.Match)))
+		}
+	}
+
+	if n := len(report.Findings); n > 0 {
+		return fmt.Errorf("%d findings in %s", n, report.Commit[:7])
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package greenleeks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// runBare makes fs itself the git directory. There is no worktree on
+// disk, so scaffolded files are written to an in-memory one and committed
+// from there; the directory's own files are never staged.
+func (i *Initializer) runBare(ctx context.Context, fs billy.Filesystem, rs *runState) (*Result, error) {
+	storage := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+
+	if err := checkBareUnderGit(fs); err != nil {
+		return nil, err
+	}
+
+	worktree := memfs.New()
+
+	scaffold, err := i.scaffoldFiles(ctx, worktree, rs.dir, rs.author, rs.committerDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare scaffolding: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := i.checkFileLimit(len(scaffold)); err != nil {
+		return nil, err
+	}
+
+	err = rs.rollback.gitDir(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	i.logger.Info("Initializing bare git repository...", "dir", rs.dir)
+
+	repo, err := git.Init(storage, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize git repository: %w", err)
+	}
+
+	err = i.setupGitDir(repo, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scaffold) == 0 && !i.allowEmpty {
+		if i.provider != nil {
+			i.logger.Warn("nothing to publish from an empty bare repository")
+		}
+		i.logger.Info("Created empty bare repository.", "dir", rs.dir)
+		return &Result{Branch: plumbing.Master.Short(), Duration: time.Since(rs.start)}, nil
+	}
+
+	err = i.writeScaffold(worktree, scaffold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write scaffolding: %w", err)
+	}
+
+	repo, err = git.Open(storage, worktree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	i.emit(Event{Type: Staging, Dir: rs.dir, Files: len(scaffold)})
+
+	endStage := i.startPhase(ctx, "stage", &rs.phases.Stage)
+	err = stageAll(ctx, repo, i.excludePatterns())
+	if err != nil {
+		return nil, fmt.Errorf("failed to add all files: %w", err)
+	}
+	endStage()
+
+	result, err := i.commitAndPublish(ctx, repo, rs, len(scaffold), nil)
+	if result == nil {
+		return nil, err
+	}
+
+	// The index only existed to build the commit; git never keeps one in
+	// a bare repository.
+	if rmErr := fs.Remove("index"); rmErr != nil && !os.IsNotExist(rmErr) {
+		i.logger.Warn("failed to remove index", "error", rmErr)
+	}
+
+	return result, err
+}
+
+// checkBareUnderGit returns ErrAlreadyUnderGit when fs is already a git
+// directory.
+func checkBareUnderGit(fs billy.Filesystem) error {
+	_, err := git.Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+	if err == nil {
+		return ErrAlreadyUnderGit
+	}
+	if err != git.ErrRepositoryNotExists {
+		return fmt.Errorf("failed to check if directory is under git control: %w", err)
+	}
+	return nil
+}
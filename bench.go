@@ -0,0 +1,71 @@
+package greenleeks
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// benchRecorder collects, from the progress events of a run, how much
+// --bench measures the scan and stage phases against.
+type benchRecorder struct {
+	scanFiles  int
+	scanBytes  int64
+	stageFiles int
+	stageBytes int64
+}
+
+// event is the WithProgress callback.
+func (b *benchRecorder) event(e Event) {
+	switch e.Type {
+	case ScanStarted:
+		*b = benchRecorder{}
+	case FileCounted:
+		b.scanFiles, b.scanBytes = e.Files, e.Bytes
+	case Staging:
+		b.stageFiles, b.stageBytes = e.Files, e.Bytes
+	}
+}
+
+// benchReport is the throughput --bench prints, in JSON under "bench".
+type benchReport struct {
+	Scan  benchPhase `json:"scan"`
+	Stage benchPhase `json:"stage"`
+}
+
+// benchPhase is the throughput of one phase; Duration is in nanoseconds in
+// JSON.
+type benchPhase struct {
+	Files          int           `json:"files"`
+	Bytes          int64         `json:"bytes"`
+	Duration       time.Duration `json:"duration"`
+	FilesPerSecond float64       `json:"files_per_second"`
+	MiBPerSecond   float64       `json:"mib_per_second"`
+}
+
+func newBenchPhase(files int, bytes int64, d time.Duration) benchPhase {
+	p := benchPhase{Files: files, Bytes: bytes, Duration: d}
+	if s := d.Seconds(); s > 0 {
+		p.FilesPerSecond = float64(files) / s
+		p.MiBPerSecond = float64(bytes) / (1 << 20) / s
+	}
+	return p
+}
+
+// report measures what b collected against the phase timings of result.
+func (b *benchRecorder) report(result *Result) *benchReport {
+	return &benchReport{
+		Scan:  newBenchPhase(b.scanFiles, b.scanBytes, result.Phases.Scan),
+		Stage: newBenchPhase(b.stageFiles, b.stageBytes, result.Phases.Stage),
+	}
+}
+
+func printBench(out io.Writer, r *benchReport) {
+	for _, p := range []struct {
+		name string
+		benchPhase
+	}{{"scan", r.Scan}, {"stage", r.Stage}} {
+		fmt.Fprintf(out, " %-5s  %7d files  %10s  %10s  %10.0f files/s  %8.1f MiB/s\n",
+			p.name, p.Files, formatSize(p.Bytes), p.Duration.Round(time.Microsecond), p.FilesPerSecond, p.MiBPerSecond)
+	}
+}
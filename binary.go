@@ -0,0 +1,65 @@
+package greenleeks
+
+import (
+	"io"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// binarySniffLen is how much of a file git looks at to tell binary from
+// text.
+const binarySniffLen = 8000
+
+// isBinaryFile reports whether name in fs looks binary to git.
+func isBinaryFile(fs billy.Filesystem, name string) (bool, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return isBinary(head[:n]), nil
+}
+
+// plannedBinaries marks the binary files in files, or with WithNoBinaries
+// drops them.
+func (i *Initializer) plannedBinaries(fs billy.Filesystem, files []PlannedFile) ([]PlannedFile, error) {
+	kept := files[:0]
+	for _, f := range files {
+		name := filepath.FromSlash(f.Path)
+		info, err := fs.Lstat(name)
+		if err != nil {
+			return nil, err
+		}
+
+		binary := false
+		if info.Mode().IsRegular() {
+			binary, err = isBinaryFile(fs, name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if binary && i.noBinaries {
+			continue
+		}
+		f.Binary = binary
+		kept = append(kept, f)
+	}
+	return kept, nil
+}
+
+// addBinaries records the files the scan found to be binary in
+// rs.binaries.
+func (rs *runState) addBinaries(files []scannedFile) {
+	for _, f := range files {
+		if f.binary {
+			rs.binaries[filepath.ToSlash(f.path)] = true
+		}
+	}
+}
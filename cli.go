@@ -0,0 +1,466 @@
+package greenleeks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+)
+
+var opts struct {
+	LogFormat string        `long:"log-format" choice:"text" choice:"json" choice:"syslog" env:"GREENLEEKS_LOG_FORMAT" description:"Log format, or syslog to send logs to the local syslog or journald (default: text on a terminal, json when stdout is not one)"`
+	Verbose   []bool        `short:"v" long:"verbose" env:"GREENLEEKS_VERBOSE" description:"Show verbose debug information, each -v bumps log level"`
+	Quiet     bool          `short:"q" long:"quiet" env:"GREENLEEKS_QUIET" description:"Print nothing but errors"`
+	LogFile   string        `long:"log-file" value-name:"PATH" env:"GREENLEEKS_LOG_FILE" description:"Write logs to this file instead of stderr, moving it to PATH.1 when it reaches --log-max-size; three old files are kept"`
+	LogSize   int64         `long:"log-max-size" value-name:"MIB" env:"GREENLEEKS_LOG_MAX_SIZE" description:"Size in MiB at which --log-file starts a new file" default:"10"`
+	NoColor   bool          `long:"no-color" env:"GREENLEEKS_NO_COLOR" description:"Do not color the text output, as NO_COLOR does"`
+	RootDir   string        `short:"r" long:"root" value-name:"DIR" env:"GREENLEEKS_ROOT" description:"Root directory" default:"."`
+	MaxFiles  int           `long:"max-files" env:"GREENLEEKS_MAX_FILES" description:"Maximum number of files to commit, not counting ignored or excluded ones" default:"100"`
+	Force     bool          `long:"force" env:"GREENLEEKS_FORCE" description:"Commit however many files there are, ignoring --max-files"`
+	GitConfig string        `long:"gitconfig" value-name:"FILE" env:"GREENLEEKS_GITCONFIG" description:"Path to the Git configuration file (default: git's global config lookup)"`
+	ConfigGit bool          `long:"configure-git" env:"GREENLEEKS_CONFIGURE_GIT" description:"If no identity is configured, write the NAME and EMAIL arguments to the global git config"`
+	AllowFake bool          `long:"allow-placeholder-identity" env:"GREENLEEKS_ALLOW_PLACEHOLDER_IDENTITY" description:"Commit as \"Your Name <your.email@example.com>\" when no identity is configured"`
+	Author    string        `long:"author" env:"GREENLEEKS_AUTHOR" description:"Author name for the initial commit, overriding the git config"`
+	Email     string        `long:"email" env:"GREENLEEKS_EMAIL" description:"Author email for the initial commit, overriding the git config"`
+	CommitMsg string        `short:"m" long:"commit-message" env:"GREENLEEKS_MESSAGE" description:"Commit message" default:"Boilerplate"`
+	NoTmpl    bool          `long:"no-commit-template" env:"GREENLEEKS_NO_COMMIT_TEMPLATE" description:"Ignore commit.template from the git config"`
+	Conv      bool          `long:"conventional" env:"GREENLEEKS_CONVENTIONAL" description:"Format the commit message as a Conventional Commits subject, e.g. \"chore: initial commit\""`
+	ConvType  string        `long:"conventional-type" choice:"build" choice:"chore" choice:"ci" choice:"docs" choice:"feat" choice:"fix" choice:"perf" choice:"refactor" choice:"style" choice:"test" env:"GREENLEEKS_CONVENTIONAL_TYPE" description:"Conventional Commits type for --conventional" default:"chore"`
+	ConvScope bool          `long:"conventional-scope" env:"GREENLEEKS_CONVENTIONAL_SCOPE" description:"With --conventional, use the directory name as the scope"`
+	Signoff   bool          `short:"s" long:"signoff" env:"GREENLEEKS_SIGNOFF" description:"Add a Signed-off-by trailer for the committer"`
+	Trailer   []string      `long:"trailer" value-name:"KEY=VALUE" env:"GREENLEEKS_TRAILER" env-delim:"," description:"Append this trailer to the commit message; repeatable"`
+	Date      string        `long:"date" env:"GREENLEEKS_DATE" description:"Date of the initial commit, in any format git accepts (default: SOURCE_DATE_EPOCH, then now)"`
+	Repro     bool          `long:"reproducible" env:"GREENLEEKS_REPRODUCIBLE" description:"Make the commit hash depend only on the files, identity and message: UTC dates defaulting to the Unix epoch, no commit.gpgsign"`
+	Bench     bool          `long:"bench" env:"GREENLEEKS_BENCH" description:"Report files/s and MiB/s for the scan and stage phases after the summary"`
+	Empty     bool          `long:"allow-empty" env:"GREENLEEKS_ALLOW_EMPTY" description:"Create an empty initial commit when there are no files to commit"`
+	Resume    bool          `long:"resume" env:"GREENLEEKS_RESUME" description:"Stage and commit in a repository that exists but has no commits yet"`
+	Amend     bool          `long:"amend" env:"GREENLEEKS_AMEND" description:"In a repository holding only what an earlier unpublished run committed, amend that commit with what changed since"`
+	Append    bool          `long:"append" env:"GREENLEEKS_APPEND" description:"Like --amend, but commit what changed in a follow-up commit"`
+	SplitBy   string        `long:"split-by" choice:"dir" choice:"type" env:"GREENLEEKS_SPLIT_BY" description:"Spread the import over several commits, one per top-level directory (dir) or per kind of file (type)"`
+	First     []string      `long:"first-commit" value-name:"PATTERN" env:"GREENLEEKS_FIRST_COMMIT" env-delim:"," description:"Commit files matching this gitignore pattern first, on their own, and the rest in a follow-up commit; repeatable"`
+	Tag       string        `long:"tag" value-name:"NAME" env:"GREENLEEKS_TAG" description:"Tag the initial commit, e.g. v0.0.0"`
+	TagMsg    string        `long:"tag-message" env:"GREENLEEKS_TAG_MESSAGE" description:"Make the --tag an annotated tag with this message"`
+	Readme    bool          `long:"scaffold-readme" env:"GREENLEEKS_SCAFFOLD_README" description:"Write a minimal README.md before committing if the directory has no README"`
+	GitAttrs  bool          `long:"gitattributes" env:"GREENLEEKS_GITATTRIBUTES" description:"Write a .gitattributes with text=auto and eol/binary rules before committing if the directory has none"`
+	KeepDirs  bool          `long:"keep-empty-dirs" env:"GREENLEEKS_KEEP_EMPTY_DIRS" description:"Write a .gitkeep into every empty directory so that it is committed"`
+	License   string        `long:"license" choice:"Apache-2.0" choice:"BSD-2-Clause" choice:"BSD-3-Clause" choice:"GPL-3.0-only" choice:"GPL-3.0-or-later" choice:"GPL-3.0" choice:"ISC" choice:"MIT" choice:"MPL-2.0" env:"GREENLEEKS_LICENSE" description:"Add a LICENSE file for this SPDX identifier before committing"`
+	Template  string        `long:"template" value-name:"DIR" env:"GREENLEEKS_TEMPLATE" description:"Copy hooks and other files from this git template directory into .git (default: GIT_TEMPLATE_DIR, then init.templateDir)"`
+	Hooks     string        `long:"install-hooks" value-name:"DIR" env:"GREENLEEKS_INSTALL_HOOKS" description:"Copy the hook scripts in this directory into .git/hooks and make them executable"`
+	HooksPath string        `long:"hooks-path" value-name:"DIR" env:"GREENLEEKS_HOOKS_PATH" description:"Set core.hooksPath in the new repository, e.g. .githooks"`
+	LFS       bool          `long:"lfs" env:"GREENLEEKS_LFS" description:"Store binaries and large files in Git LFS, writing .gitattributes for them"`
+	LFSSize   int64         `long:"lfs-threshold" value-name:"MIB" env:"GREENLEEKS_LFS_THRESHOLD" description:"Size in MiB from which any file belongs in Git LFS" default:"10"`
+	NoBinary  bool          `long:"no-binaries" env:"GREENLEEKS_NO_BINARIES" description:"Leave binary files out of the initial commit"`
+	Symlinks  string        `long:"symlinks" choice:"follow" choice:"keep" choice:"skip" env:"GREENLEEKS_SYMLINKS" description:"Commit symlinks as links (keep), commit what they point at (follow) or leave them out (skip)" default:"keep"`
+	Nested    string        `long:"nested-repos" choice:"embed" choice:"skip" choice:"abort" choice:"submodule" env:"GREENLEEKS_NESTED_REPOS" description:"What to do with subdirectories that are repositories of their own: commit them as gitlinks (embed), also register them in .gitmodules (submodule), leave them out (skip), or stop (abort)" default:"embed"`
+	NoVerify  bool          `short:"n" long:"no-verify" env:"GREENLEEKS_NO_VERIFY" description:"Do not run the pre-commit hook before committing"`
+	FromTmpl  string        `long:"from-template" value-name:"URL" env:"GREENLEEKS_FROM_TEMPLATE" description:"Copy the files of this repository, without history, into the directory before committing; append #branch to pick a branch"`
+	Bare      bool          `long:"bare" env:"GREENLEEKS_BARE" description:"Create a bare repository; only scaffolded files are committed"`
+	GitDir    string        `long:"separate-git-dir" value-name:"DIR" env:"GREENLEEKS_SEPARATE_GIT_DIR" description:"Store the repository in this directory and leave a .git file pointing at it"`
+	Dotfiles  bool          `long:"dotfiles" env:"GREENLEEKS_DOTFILES" description:"Commit an allowlist of dotfiles from the home directory (or --root) to ~/.dotfiles.git (or --separate-git-dir), leaving no .git behind"`
+	Dotfile   []string      `long:"dotfile" value-name:"PATH" env:"GREENLEEKS_DOTFILE" env-delim:"," description:"With --dotfiles, commit this path instead of the default allowlist; repeatable"`
+	Hidden    string        `long:"hidden" choice:"include" choice:"exclude" env:"GREENLEEKS_HIDDEN" description:"Commit hidden files and directories, or leave them out apart from .gitignore and the like" default:"include"`
+	MaxDepth  int           `long:"max-depth" value-name:"N" env:"GREENLEEKS_MAX_DEPTH" description:"Leave out files deeper than N, counting top-level files as depth 1 (default: no limit)"`
+	ScanTmout time.Duration `long:"scan-timeout" value-name:"DURATION" env:"GREENLEEKS_SCAN_TIMEOUT" description:"Give up if walking the directory takes longer than this, e.g. 30s (default: no limit)"`
+	Timeout   time.Duration `long:"timeout" value-name:"DURATION" env:"GREENLEEKS_TIMEOUT" description:"Give up if the whole run takes longer than this, e.g. 5m (default: no limit)"`
+	Exclude   []string      `long:"exclude" env:"GREENLEEKS_EXCLUDE" env-delim:"," description:"Leave files matching this gitignore pattern out of the commit; repeatable"`
+	Sign      bool          `short:"S" long:"sign" env:"GREENLEEKS_SIGN" description:"GPG-sign the initial commit"`
+	Keyring   string        `long:"signing-keyring" value-name:"FILE" env:"GREENLEEKS_SIGNING_KEYRING" description:"Read the signing key from this OpenPGP keyring file instead of gpg-agent"`
+	SSHKey    string        `long:"ssh-signing-key" value-name:"FILE" env:"GREENLEEKS_SSH_SIGNING_KEY" description:"Sign the initial commit with this SSH key (implies --sign)"`
+	NoSign    bool          `long:"no-sign" env:"GREENLEEKS_NO_SIGN" description:"Do not sign the initial commit, even if commit.gpgsign is set"`
+	Provider  string        `long:"provider" choice:"forgejo" choice:"gitea" env:"GREENLEEKS_PROVIDER" description:"Create a remote repository on this hosting provider and push to it"`
+	BaseURL   string        `long:"provider-url" env:"GREENLEEKS_PROVIDER_URL" description:"Base URL of the hosting provider, e.g. https://codeberg.org"`
+	Token     string        `long:"provider-token" env:"GREENLEEKS_PROVIDER_TOKEN" description:"API token for the hosting provider"`
+	Private   bool          `long:"private" env:"GREENLEEKS_PRIVATE" description:"Create the remote repository as private"`
+	Retries   int           `long:"retries" value-name:"N" env:"GREENLEEKS_RETRIES" description:"Retry creating the remote repository and pushing this many times on network errors and 5xx answers" default:"3"`
+	Rate      int           `long:"provider-rate" value-name:"N" env:"GREENLEEKS_PROVIDER_RATE" description:"Create at most this many remote repositories a minute, spaced evenly, for batches with adopt and watch; 0 for no limit"`
+	Metrics   string        `long:"metrics-addr" value-name:"ADDR" env:"GREENLEEKS_METRICS_ADDR" description:"Serve Prometheus metrics on this address, e.g. :9090, for as long as greenleeks runs"`
+	ShowVer   bool          `long:"version" description:"Print the version and exit"`
+	Profile   string        `long:"profile" env:"GREENLEEKS_PROFILE" description:"Use this profile from the config file"`
+
+	Init struct{} `command:"init" description:"Initialize the directory and commit its contents (default)"`
+	Plan struct {
+		Largest int `long:"largest" value-name:"N" description:"List this many of the largest files after the summary, 0 for none" default:"5"`
+	} `command:"plan" description:"Show what init would commit without changing anything"`
+	Status struct {
+		Dirty bool `long:"dirty" description:"Also list repositories with uncommitted changes"`
+	} `command:"status" description:"List subdirectories of DIR (default: --root) that are not under git control"`
+	Watch struct {
+		Settle   time.Duration `long:"settle" value-name:"DURATION" description:"Wait until nothing has been written to a new directory for this long" default:"10s"`
+		Every    time.Duration `long:"every" value-name:"DURATION" description:"Instead of watching, initialize every subdirectory that is not a repository, now and at this interval, e.g. 15m; for NFS and the like"`
+		Takeover bool          `long:"takeover" description:"Stop the watch already running for DIR and take its place"`
+	} `command:"watch" description:"Initialize each directory created in DIR (default: --root) from now on, once it has settled"`
+	Stats struct {
+		Largest int `long:"largest" value-name:"N" description:"List this many of the largest files" default:"10"`
+	} `command:"stats" description:"Break down what init would commit by file extension, with the largest files"`
+	Adopt      struct{} `command:"adopt" description:"Publish DIR (default: --root), or each repository below it, that has commits but no remote, with --provider"`
+	Doctor     struct{} `command:"doctor" description:"Check the git config, identity, signing key, provider token and DIR (default: --root) for what init needs"`
+	Audit      struct{} `command:"audit" description:"Report secrets and sensitive files in the commit init made in DIR (default: --root)"`
+	Undo       struct{} `command:"undo" description:"Remove the repository init created in DIR (default: --root), if nothing was committed to it since"`
+	Completion struct{} `command:"completion" description:"Print a completion script for bash, zsh or fish"`
+	SelfUpdate struct {
+		Check bool `long:"check" description:"Only report whether a newer release exists"`
+		Force bool `long:"force" description:"Replace a build that is not a release, such as a development build"`
+	} `command:"self-update" description:"Replace this binary with the latest release"`
+	Version struct{} `command:"version" description:"Print the version and exit"`
+
+	logLevel slog.Level
+	args     []string
+	command  string
+}
+
+const defaultCommand = "init"
+
+// commands maps subcommand names to their implementation. Options are
+// shared by all of them.
+var commands = map[string]func() error{
+	"init":        run,
+	"plan":        runPlan,
+	"stats":       runStats,
+	"status":      runStatus,
+	"watch":       runWatch,
+	"adopt":       runAdopt,
+	"undo":        runUndo,
+	"doctor":      runDoctor,
+	"audit":       runAudit,
+	"completion":  runCompletion,
+	"self-update": runSelfUpdate,
+	"version":     printVersion,
+}
+
+// Exit codes returned by Execute.
+const (
+	exitOK           = 0
+	exitFailure      = 1
+	exitTooManyFiles = 2
+	exitNoIdentity   = 3
+)
+
+func Execute() int {
+	if err := parseFlags(); err != nil {
+		return exitFailure
+	}
+
+	if err := setLogLevel(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	if err := setupLogger(); err != nil {
+		return exitFailure
+	}
+
+	shutdown, err := setupTracing()
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		return exitFailure
+	}
+	defer shutdown()
+
+	if opts.Metrics != "" {
+		if err := serveMetrics(opts.Metrics); err != nil {
+			slog.Error("failed to serve metrics", "error", err)
+			return exitFailure
+		}
+	}
+
+	err = commands[opts.command]()
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, ErrAlreadyUnderGit):
+		slog.Info("Directory is already under git control.")
+		return exitOK
+	case errors.Is(err, ErrTooManyFiles):
+		slog.Error("run failed", "error", err, "hint", "raise --max-files, or pass --force if the import is intended")
+		return exitTooManyFiles
+	case errors.Is(err, ErrNothingToCommit):
+		slog.Error("run failed", "error", err, "hint", "pass --allow-empty to create an empty initial commit")
+		return exitFailure
+	case errors.Is(err, ErrNestedRepository):
+		slog.Error("run failed", "error", err, "hint", "pass --nested-repos embed, submodule or skip")
+		return exitFailure
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.Error("run failed", "error", err, "hint", "raise --timeout")
+		return exitFailure
+	case errors.Is(err, ErrNoIdentity):
+		slog.Error("run failed", "error", err, "hint", "pass --author and --email, --configure-git NAME EMAIL, or --allow-placeholder-identity")
+		return exitNoIdentity
+	default:
+		slog.Error("run failed", "error", err)
+		return exitFailure
+	}
+}
+
+func newParser() *flags.Parser {
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.Usage = "[OPTIONS] [init] [--configure-git NAME EMAIL]"
+	parser.SubcommandsOptional = true
+	return parser
+}
+
+func parseFlags() error {
+	parser := newParser()
+	args, err := parser.ParseArgs(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	opts.args = args
+
+	opts.command = defaultCommand
+	if parser.Active != nil {
+		opts.command = parser.Active.Name
+	}
+	if opts.ShowVer {
+		opts.command = "version"
+	}
+
+	if err := applyConfigFiles(parser); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	if opts.LogFormat == "" {
+		opts.LogFormat = defaultLogFormat()
+	}
+
+	if opts.Dotfiles {
+		if err := dotfilesRoot(parser); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func run() error {
+	options, err := cliOptions()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	var progress []func(Event)
+	defer stderrBar.done()
+	if showProgress() {
+		progress = append(progress, stderrBar.event)
+	}
+	var bench *benchRecorder
+	if opts.Bench {
+		bench = &benchRecorder{}
+		progress = append(progress, bench.event)
+	}
+	if len(progress) > 0 {
+		options = append(options, WithProgress(func(e Event) {
+			for _, fn := range progress {
+				fn(e)
+			}
+		}))
+	}
+
+	result, err := New(options...).Run(ctx, opts.RootDir)
+	// A failed run takes back what it wrote, so it can simply be run
+	// again with what the user picks.
+	for errors.Is(err, ErrTooManyFiles) && !opts.Quiet && isTerminal(os.Stdin) && isTerminal(os.Stderr) {
+		stderrBar.done()
+		more, promptErr := promptFileLimit(ctx, options)
+		if promptErr != nil || more == nil {
+			break
+		}
+		options = append(options, more...)
+		result, err = New(options...).Run(ctx, opts.RootDir)
+	}
+	recordRun(result, err)
+	if result != nil && result.CommitHash != "" && !opts.Quiet {
+		var report *benchReport
+		if bench != nil {
+			report = bench.report(result)
+		}
+		printResult(os.Stdout, result, report)
+	}
+	return err
+}
+
+// printResult prints a summary of result, and the --bench report if any,
+// as JSON with --log-format json.
+func printResult(out io.Writer, result *Result, bench *benchReport) {
+	if opts.LogFormat == "json" {
+		v := struct {
+			*Result
+			Bench *benchReport `json:"bench,omitempty"`
+		}{result, bench}
+		if err := json.NewEncoder(out).Encode(v); err != nil {
+			slog.Warn("failed to write result", "error", err)
+		}
+		return
+	}
+
+	root := ""
+	if result.RootCommit {
+		root = " (root-commit)"
+	}
+	fmt.Fprintln(out, paint(colorGreen, fmt.Sprintf("[%s%s %s] %s", result.Branch, root, result.ShortHash(), firstLine(result.Message))))
+	if len(result.Skipped) > 0 {
+		fmt.Fprintln(out, paint(colorYellow, " left out: "+strings.Join(result.Skipped, ", ")))
+	}
+	if len(result.CutOff) > 0 {
+		fmt.Fprintln(out, paint(colorYellow, fmt.Sprintf(" left out below depth %d: %s", opts.MaxDepth, strings.Join(result.CutOff, ", "))))
+	}
+	if len(result.NestedRepos) > 0 {
+		fmt.Fprintf(out, " nested repositories (%s): %s\n", opts.Nested, strings.Join(result.NestedRepos, ", "))
+	}
+	if result.BinaryFiles > 0 {
+		fmt.Fprintf(out, " %d files, %d binary\n", result.FilesAdded, result.BinaryFiles)
+	}
+	if bench != nil {
+		printBench(out, bench)
+	}
+}
+
+// interruptContext is cancelled on SIGINT or SIGTERM, or once --timeout
+// has passed, so that a command stops at the next step boundary.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(tracingContext(), os.Interrupt, syscall.SIGTERM)
+	if opts.Timeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// cliOptions translates the parsed flags into Initializer options.
+func cliOptions() ([]Option, error) {
+	options := []Option{
+		WithMaxFiles(opts.MaxFiles),
+		WithUnlimitedFiles(opts.Force),
+		WithMessage(opts.CommitMsg),
+		WithIgnoreCommitTemplate(opts.NoTmpl),
+		WithReproducible(opts.Repro),
+		WithAllowEmpty(opts.Empty),
+		WithResume(opts.Resume),
+		WithSplitBy(SplitMode(opts.SplitBy)),
+		WithFirstCommit(opts.First...),
+		WithSignoff(opts.Signoff),
+		WithTag(opts.Tag, opts.TagMsg),
+		WithExcludes(opts.Exclude...),
+		WithExcludeHidden(opts.Hidden == "exclude"),
+		WithMaxDepth(opts.MaxDepth),
+		WithScanTimeout(opts.ScanTmout),
+		WithNestedRepos(NestedRepoPolicy(opts.Nested)),
+		WithScaffoldReadme(opts.Readme),
+		WithGitattributes(opts.GitAttrs),
+		WithKeepEmptyDirs(opts.KeepDirs),
+		WithLicense(opts.License),
+		WithTemplateDir(opts.Template),
+		WithHooksDir(opts.Hooks),
+		WithHooksPath(opts.HooksPath),
+		WithLFS(opts.LFS),
+		WithLFSThreshold(opts.LFSSize << 20),
+		WithNoBinaries(opts.NoBinary),
+		WithSymlinks(SymlinkPolicy(opts.Symlinks)),
+		WithNoVerify(opts.NoVerify),
+		WithFromTemplate(opts.FromTmpl),
+		WithBare(opts.Bare),
+		WithSeparateGitDir(opts.GitDir),
+		WithGitConfig(opts.GitConfig),
+		WithAuthor(opts.Author, opts.Email),
+		WithAllowPlaceholderIdentity(opts.AllowFake),
+		WithIdentityFallback(cliIdentityFallback),
+		WithSigningKeyring(opts.Keyring),
+		WithSSHSigningKey(opts.SSHKey),
+		WithLogger(slog.Default()),
+	}
+
+	if opts.Date != "" {
+		date, err := parseGitDate(opts.Date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --date: %v", err)
+		}
+		options = append(options, WithDate(date))
+	}
+
+	for _, t := range opts.Trailer {
+		key, value, err := parseTrailer(t)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithTrailer(key, value))
+	}
+
+	if opts.Conv {
+		options = append(options, WithConventional(opts.ConvType, opts.ConvScope))
+	}
+
+	if opts.Dotfiles {
+		options = append(options, WithDotfiles(opts.Dotfile...))
+	}
+
+	switch {
+	case opts.Amend && opts.Append:
+		return nil, errors.New("--amend and --append cannot be combined")
+	case opts.Amend:
+		options = append(options, WithRerun(RerunAmend))
+	case opts.Append:
+		options = append(options, WithRerun(RerunAppend))
+	}
+
+	switch {
+	case opts.NoSign:
+		options = append(options, WithSignMode(SignNever))
+	case opts.Sign:
+		options = append(options, WithSignMode(SignAlways))
+	}
+
+	if opts.Provider != "" {
+		provider, err := newProvider(opts.Provider, opts.BaseURL, opts.Token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure provider: %v", err)
+		}
+		if opts.Rate < 0 {
+			return nil, fmt.Errorf("--provider-rate must not be negative, got %d", opts.Rate)
+		}
+		provider = NewRateLimitedProvider(provider, opts.Rate)
+		options = append(options, WithProvider(provider), WithPrivateRemote(opts.Private), WithRetries(opts.Retries))
+	}
+
+	return options, nil
+}
+
+// cliIdentityFallback handles --configure-git and, on a terminal, asks for
+// whatever identity is still missing.
+func cliIdentityFallback(ai AuthorInfo) (AuthorInfo, error) {
+	var err error
+
+	if opts.ConfigGit {
+		ai, err = configureGitIdentity(ai, opts.args)
+		if err != nil {
+			return ai, err
+		}
+	}
+
+	if ai.IsPlaceholder() && isTerminal(os.Stdin) {
+		return promptForIdentity(ai)
+	}
+
+	return ai, nil
+}
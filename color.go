@@ -0,0 +1,59 @@
+package greenleeks
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// ANSI colors for the text output on a terminal.
+const (
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorRed    = "\033[31m"
+	colorReset  = "\033[0m"
+)
+
+// colorEnabled reports whether text output to f gets colors: f is a
+// terminal, the log format is text and neither --no-color nor NO_COLOR
+// asks otherwise.
+func colorEnabled(f *os.File) bool {
+	if opts.NoColor || os.Getenv("NO_COLOR") != "" || opts.LogFormat != "text" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// paint colors s for stdout, if colorEnabled allows.
+func paint(color, s string) string {
+	if !colorEnabled(os.Stdout) {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// levelColorWriter colors the records a slog.TextHandler writes to w by
+// level: errors red and warnings yellow. The handler writes each record in
+// a single call, starting with its level.
+type levelColorWriter struct {
+	w io.Writer
+}
+
+func (c levelColorWriter) Write(p []byte) (int, error) {
+	var color string
+	switch {
+	case bytes.HasPrefix(p, []byte("level=ERROR")):
+		color = colorRed
+	case bytes.HasPrefix(p, []byte("level=WARN")):
+		color = colorYellow
+	default:
+		return c.w.Write(p)
+	}
+
+	line := bytes.TrimSuffix(p, []byte("\n"))
+	_, err := io.WriteString(c.w, color+string(line)+colorReset+"\n")
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,390 @@
+package greenleeks
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+)
+
+const programName = "greenleeks"
+
+// Value names that tell the completion scripts to offer paths.
+const (
+	valueNameDir  = "DIR"
+	valueNameFile = "FILE"
+)
+
+// completionOption is a flag as the completion scripts need to see it.
+type completionOption struct {
+	short       string
+	long        string
+	description string
+	takesValue  bool
+	repeatable  bool
+	valueName   string
+	choices     []string
+}
+
+type completionCommand struct {
+	name        string
+	description string
+	options     []completionOption
+	// words lists the values of the command's positional argument, and
+	// dirArg marks a command whose positional argument is a directory.
+	words  []string
+	dirArg bool
+}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func runCompletion() error {
+	if len(opts.args) != 1 {
+		return fmt.Errorf("completion takes one shell name: %s", strings.Join(completionShells, ", "))
+	}
+
+	global, commands := completionModel(newParser())
+
+	switch opts.args[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout, global, commands)
+	case "zsh":
+		writeZshCompletion(os.Stdout, global, commands)
+	case "fish":
+		writeFishCompletion(os.Stdout, global, commands)
+	default:
+		return fmt.Errorf("unsupported shell %q, want one of %s", opts.args[0], strings.Join(completionShells, ", "))
+	}
+
+	return nil
+}
+
+// completionModel collects the options and commands of parser so that the
+// scripts always match the flags the binary actually accepts.
+func completionModel(parser *flags.Parser) ([]completionOption, []completionCommand) {
+	global := groupOptions(parser.Group)
+
+	var commands []completionCommand
+	for _, cmd := range parser.Commands() {
+		if cmd.Hidden {
+			continue
+		}
+		c := completionCommand{
+			name:        cmd.Name,
+			description: cmd.ShortDescription,
+			options:     groupOptions(cmd.Group),
+		}
+		switch cmd.Name {
+		case "completion":
+			c.words = completionShells
+		case "status":
+			c.dirArg = true
+		}
+		commands = append(commands, c)
+	}
+
+	return global, commands
+}
+
+func groupOptions(group *flags.Group) []completionOption {
+	var options []completionOption
+	for _, o := range group.Options() {
+		if o.Hidden {
+			continue
+		}
+
+		t := reflect.TypeOf(o.Value())
+		repeatable := t.Kind() == reflect.Slice
+		if repeatable {
+			t = t.Elem()
+		}
+
+		co := completionOption{
+			long:        o.LongName,
+			description: o.Description,
+			takesValue:  t.Kind() != reflect.Bool,
+			repeatable:  repeatable,
+			valueName:   o.ValueName,
+			choices:     o.Choices,
+		}
+		if o.ShortName != 0 {
+			co.short = string(o.ShortName)
+		}
+		options = append(options, co)
+	}
+
+	for _, g := range group.Groups() {
+		options = append(options, groupOptions(g)...)
+	}
+
+	return options
+}
+
+func (o completionOption) names() []string {
+	var names []string
+	if o.short != "" {
+		names = append(names, "-"+o.short)
+	}
+	if o.long != "" {
+		names = append(names, "--"+o.long)
+	}
+	return names
+}
+
+func optionNames(options []completionOption) string {
+	var names []string
+	for _, o := range options {
+		names = append(names, o.names()...)
+	}
+	return strings.Join(names, " ")
+}
+
+func commandNames(commands []completionCommand) []string {
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+func writeBashCompletion(out io.Writer, global []completionOption, commands []completionCommand) {
+	all := append([]completionOption{}, global...)
+	for _, c := range commands {
+		all = append(all, c.options...)
+	}
+
+	fmt.Fprintf(out, "# bash completion for %s\n", programName)
+	fmt.Fprintf(out, "_%s() {\n", programName)
+	fmt.Fprint(out, `	local cur prev cmd i
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+	# COMP_WORDBREAKS splits --opt=value into separate words.
+	if [[ "$cur" == "=" ]]; then
+		cur=""
+	elif [[ "$prev" == "=" ]]; then
+		prev="${COMP_WORDS[COMP_CWORD-2]}"
+	fi
+
+	case "$prev" in
+`)
+	var files, dirs, other []string
+	for _, o := range all {
+		if !o.takesValue {
+			continue
+		}
+		pattern := strings.Join(o.names(), "|")
+		switch {
+		case len(o.choices) > 0:
+			fmt.Fprintf(out, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", pattern, strings.Join(o.choices, " "))
+		case o.valueName == valueNameDir:
+			dirs = append(dirs, pattern)
+		case o.valueName == valueNameFile:
+			files = append(files, pattern)
+		default:
+			other = append(other, pattern)
+		}
+	}
+	if len(dirs) > 0 {
+		fmt.Fprintf(out, "\t%s) COMPREPLY=($(compgen -d -- \"$cur\")); return ;;\n", strings.Join(dirs, "|"))
+	}
+	if len(files) > 0 {
+		fmt.Fprintf(out, "\t%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", strings.Join(files, "|"))
+	}
+	if len(other) > 0 {
+		fmt.Fprintf(out, "\t%s) COMPREPLY=(); return ;;\n", strings.Join(other, "|"))
+	}
+	fmt.Fprintf(out, `	esac
+
+	cmd=""
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case "${COMP_WORDS[i]}" in
+		%s) cmd="${COMP_WORDS[i]}" ;;
+		esac
+	done
+
+	local opts=%q
+	case "$cmd" in
+`, strings.Join(commandNames(commands), "|"), optionNames(global))
+	for _, c := range commands {
+		if len(c.options) > 0 {
+			fmt.Fprintf(out, "\t%s) opts=\"$opts %s\" ;;\n", c.name, optionNames(c.options))
+		}
+	}
+	fmt.Fprintf(out, `	esac
+
+	if [[ "$cur" == -* ]]; then
+		COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+		return
+	fi
+
+	case "$cmd" in
+	"") COMPREPLY=($(compgen -W %q -- "$cur")) ;;
+`, strings.Join(commandNames(commands), " "))
+	for _, c := range commands {
+		switch {
+		case len(c.words) > 0:
+			fmt.Fprintf(out, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", c.name, strings.Join(c.words, " "))
+		case c.dirArg:
+			fmt.Fprintf(out, "\t%s) COMPREPLY=($(compgen -d -- \"$cur\")) ;;\n", c.name)
+		}
+	}
+	fmt.Fprintf(out, `	esac
+}
+complete -o default -F _%s %s
+`, programName, programName)
+}
+
+// zshQuote quotes s for use inside single quotes in an _arguments spec,
+// where ] and : are also special.
+func zshQuote(s string) string {
+	r := strings.NewReplacer(`'`, `'\''`, `]`, `\]`, `:`, `\:`)
+	return r.Replace(s)
+}
+
+func zshSpec(o completionOption) string {
+	var action string
+	if o.takesValue {
+		switch {
+		case len(o.choices) > 0:
+			action = fmt.Sprintf(":%s:(%s)", o.long, strings.Join(o.choices, " "))
+		case o.valueName == valueNameDir:
+			action = fmt.Sprintf(":%s:_files -/", o.long)
+		case o.valueName == valueNameFile:
+			action = fmt.Sprintf(":%s:_files", o.long)
+		default:
+			action = fmt.Sprintf(":%s: ", o.long)
+		}
+	}
+
+	eq := ""
+	if o.takesValue {
+		eq = "="
+	}
+	desc := "[" + zshQuote(o.description) + "]"
+	rep := ""
+	if o.repeatable {
+		rep = "*"
+	}
+
+	if o.short != "" && o.long != "" {
+		prefix := fmt.Sprintf("(-%s --%s)", o.short, o.long)
+		if o.repeatable {
+			prefix = rep
+		}
+		return fmt.Sprintf("'%s'{-%s,--%s%s}'%s%s'", prefix, o.short, o.long, eq, desc, action)
+	}
+
+	name := "--" + o.long
+	if o.long == "" {
+		name = "-" + o.short
+		eq = ""
+	}
+	return fmt.Sprintf("'%s%s%s%s%s'", rep, name, eq, desc, action)
+}
+
+func writeZshCompletion(out io.Writer, global []completionOption, commands []completionCommand) {
+	fmt.Fprintf(out, "#compdef %s\n\n", programName)
+	fmt.Fprintf(out, "_%s() {\n", programName)
+	fmt.Fprint(out, "\tlocal curcontext=\"$curcontext\" state line\n")
+	fmt.Fprint(out, "\tlocal -a global commands\n\n\tglobal=(\n")
+	for _, o := range global {
+		fmt.Fprintf(out, "\t\t%s\n", zshSpec(o))
+	}
+	fmt.Fprint(out, "\t)\n\n\tcommands=(\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "\t\t'%s:%s'\n", c.name, zshQuote(c.description))
+	}
+	fmt.Fprint(out, `	)
+
+	_arguments -C $global '1: :->command' '*:: :->args'
+
+	case $state in
+	command)
+		_describe -t commands 'command' commands
+		;;
+	args)
+		case $line[1] in
+`)
+	for _, c := range commands {
+		fmt.Fprintf(out, "\t\t%s)\n\t\t\t_arguments $global", c.name)
+		for _, o := range c.options {
+			fmt.Fprintf(out, " %s", zshSpec(o))
+		}
+		switch {
+		case len(c.words) > 0:
+			fmt.Fprintf(out, " '1:%s:(%s)'", c.name, strings.Join(c.words, " "))
+		case c.dirArg:
+			fmt.Fprint(out, " '1:directory:_files -/'")
+		}
+		fmt.Fprint(out, "\n\t\t\t;;\n")
+	}
+	fmt.Fprintf(out, `		esac
+		;;
+	esac
+}
+
+compdef _%s %s
+`, programName, programName)
+}
+
+// fishQuote quotes s as a fish single-quoted string.
+func fishQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + r.Replace(s) + "'"
+}
+
+func writeFishOption(out io.Writer, condition string, o completionOption) {
+	fmt.Fprintf(out, "complete -c %s", programName)
+	if condition != "" {
+		fmt.Fprintf(out, " -n %s", fishQuote(condition))
+	}
+	if o.short != "" {
+		fmt.Fprintf(out, " -s %s", o.short)
+	}
+	if o.long != "" {
+		fmt.Fprintf(out, " -l %s", o.long)
+	}
+	if o.takesValue {
+		switch {
+		case len(o.choices) > 0:
+			fmt.Fprintf(out, " -x -a %s", fishQuote(strings.Join(o.choices, " ")))
+		case o.valueName == valueNameDir:
+			fmt.Fprint(out, " -x -a '(__fish_complete_directories)'")
+		case o.valueName == valueNameFile:
+			fmt.Fprint(out, " -r -F")
+		default:
+			fmt.Fprint(out, " -x")
+		}
+	}
+	fmt.Fprintf(out, " -d %s\n", fishQuote(o.description))
+}
+
+func writeFishCompletion(out io.Writer, global []completionOption, commands []completionCommand) {
+	names := strings.Join(commandNames(commands), " ")
+
+	fmt.Fprintf(out, "# fish completion for %s\n", programName)
+	fmt.Fprintf(out, "complete -c %s -f\n", programName)
+	for _, c := range commands {
+		fmt.Fprintf(out, "complete -c %s -n %s -a %s -d %s\n",
+			programName, fishQuote("not __fish_seen_subcommand_from "+names), c.name, fishQuote(c.description))
+	}
+	for _, o := range global {
+		writeFishOption(out, "", o)
+	}
+	for _, c := range commands {
+		condition := fishQuote("__fish_seen_subcommand_from " + c.name)
+		switch {
+		case len(c.words) > 0:
+			fmt.Fprintf(out, "complete -c %s -n %s -a %s\n", programName, condition, fishQuote(strings.Join(c.words, " ")))
+		case c.dirArg:
+			fmt.Fprintf(out, "complete -c %s -n %s -a '(__fish_complete_directories)'\n", programName, condition)
+		}
+		for _, o := range c.options {
+			writeFishOption(out, "__fish_seen_subcommand_from "+c.name, o)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package greenleeks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	projectConfigFileName = ".greenleeks.yaml"
+	profileKey            = "profile"
+	profilesKey           = "profiles"
+)
+
+// userOnlySettings can be set in the user's config file but not in the
+// .greenleeks.yaml of a directory, which may come from anywhere: they
+// decide where credentials go, what runs, what is written outside the
+// directory and who signs.
+var userOnlySettings = map[string]bool{
+	"author":                     true,
+	"email":                      true,
+	"allow-placeholder-identity": true,
+	"configure-git":              true,
+	"gitconfig":                  true,
+	"provider":                   true,
+	"provider-url":               true,
+	"provider-token":             true,
+	"hooks-path":                 true,
+	"install-hooks":              true,
+	"no-verify":                  true,
+	"template":                   true,
+	"from-template":              true,
+	"sign":                       true,
+	"no-sign":                    true,
+	"signing-keyring":            true,
+	"ssh-signing-key":            true,
+	"separate-git-dir":           true,
+	"dotfiles":                   true,
+	"root":                       true,
+	"force":                      true,
+	"log-file":                   true,
+	"metrics-addr":               true,
+}
+
+// configFile holds settings read from a greenleeks config file. Keys are
+// long flag names; profile picks a default entry from profiles, whose
+// settings override the top-level ones.
+type configFile struct {
+	settings map[string]interface{}
+	profile  string
+	profiles map[string]map[string]interface{}
+}
+
+// configFilePaths lists the config files in increasing precedence: the
+// user's $XDG_CONFIG_HOME/greenleeks/config.yaml, then .greenleeks.yaml in
+// the directory being initialized.
+func configFilePaths(rootDir string) ([]string, error) {
+	configHome, err := xdgConfigHome()
+	if err != nil {
+		return nil, err
+	}
+
+	return existingFiles(
+		filepath.Join(configHome, "greenleeks", "config.yaml"),
+		filepath.Join(rootDir, projectConfigFileName),
+	), nil
+}
+
+func readConfigFile(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	cf := &configFile{
+		settings: map[string]interface{}{},
+		profiles: map[string]map[string]interface{}{},
+	}
+
+	for key, value := range raw {
+		switch key {
+		case profileKey:
+			name, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s must be a string", path, profileKey)
+			}
+			cf.profile = name
+		case profilesKey:
+			profiles, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: %s must be a mapping", path, profilesKey)
+			}
+			for name, settings := range profiles {
+				m, ok := settings.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s: profile %q must be a mapping", path, name)
+				}
+				cf.profiles[name] = m
+			}
+		default:
+			cf.settings[key] = value
+		}
+	}
+
+	return cf, nil
+}
+
+// checkProjectSettings rejects the userOnlySettings in cf, read from the
+// .greenleeks.yaml at path, profiles included.
+func checkProjectSettings(path string, cf *configFile) error {
+	check := func(settings map[string]interface{}) error {
+		keys := make([]string, 0, len(settings))
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if userOnlySettings[key] {
+				return fmt.Errorf("%s: %s can only be set in the user config file or on the command line", path, key)
+			}
+		}
+		return nil
+	}
+
+	if err := check(cf.settings); err != nil {
+		return err
+	}
+	for _, settings := range cf.profiles {
+		if err := check(settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConfigFiles fills in every option not given on the command line or
+// through its GREENLEEKS_* variable from the config files, with the
+// selected profile taking precedence over top-level settings. A
+// .greenleeks.yaml may not set the userOnlySettings.
+func applyConfigFiles(parser *flags.Parser) error {
+	paths, err := configFilePaths(opts.RootDir)
+	if err != nil {
+		return err
+	}
+
+	var files []*configFile
+	for _, path := range paths {
+		cf, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		if filepath.Base(path) == projectConfigFileName {
+			if err := checkProjectSettings(path, cf); err != nil {
+				return err
+			}
+		}
+		files = append(files, cf)
+	}
+
+	settings := map[string]interface{}{}
+	profile := ""
+	for _, cf := range files {
+		for key, value := range cf.settings {
+			settings[key] = value
+		}
+		if cf.profile != "" {
+			profile = cf.profile
+		}
+	}
+	if opts.Profile != "" {
+		profile = opts.Profile
+	}
+
+	if profile != "" {
+		found := false
+		for _, cf := range files {
+			if p, ok := cf.profiles[profile]; ok {
+				found = true
+				for key, value := range p {
+					settings[key] = value
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("profile %q is not defined in %v", profile, paths)
+		}
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		option := parser.FindOptionByLongName(key)
+		if option == nil {
+			return fmt.Errorf("unknown setting %q in config file", key)
+		}
+		if option.IsSet() && !option.IsSetDefault() {
+			continue
+		}
+		if env := option.EnvKeyWithNamespace(); env != "" {
+			if _, ok := os.LookupEnv(env); ok {
+				continue
+			}
+		}
+		if err := setOption(option, settings[key]); err != nil {
+			return fmt.Errorf("invalid value for %s in config file: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+func setOption(option *flags.Option, value interface{}) error {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	for _, v := range values {
+		s := fmt.Sprint(v)
+		if err := option.Set(&s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,19 @@
+package greenleeks
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// excludePatterns returns the WithExcludes patterns plus, with
+// WithMaxDepth, one matching everything below the depth limit.
+func (i *Initializer) excludePatterns() []gitignore.Pattern {
+	if i.maxDepth <= 0 {
+		return i.excludes
+	}
+	// With a depth of 2, "*/*/*" matches a/b/c, file or directory, which
+	// takes everything under a/b/c with it.
+	depth := gitignore.ParsePattern(strings.Repeat("*/", i.maxDepth)+"*", nil)
+	return append(i.excludes[:len(i.excludes):len(i.excludes)], depth)
+}
@@ -0,0 +1,252 @@
+package greenleeks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CheckStatus is the outcome of one Doctor check.
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckFail CheckStatus = "fail"
+	// CheckSkip is for a check that does not apply with the options given.
+	CheckSkip CheckStatus = "skip"
+)
+
+// Check is the result of one Doctor check.
+type Check struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	// Detail says what was found.
+	Detail string `json:"detail"`
+	// Hint says how to fix a failed check.
+	Hint string `json:"hint,omitempty"`
+}
+
+// userChecker is implemented by providers that can tell whose token they
+// hold, which Doctor uses to check it.
+type userChecker interface {
+	currentUser(ctx context.Context) (string, error)
+}
+
+// Doctor checks, without changing anything, what Run needs for dir with
+// the options given: a readable git config, an identity, a writable
+// directory, the signing key and the provider token.
+func (i *Initializer) Doctor(ctx context.Context, dir string) []Check {
+	var checks []Check
+
+	config, err := i.readGitConfig(dir)
+	if err != nil {
+		checks = append(checks, Check{Name: "gitconfig", Status: CheckFail, Detail: err.Error(),
+			Hint: "fix the file, or point --gitconfig at another one"})
+	} else {
+		c := Check{Name: "gitconfig", Status: CheckPass, Detail: "no git config files found"}
+		if paths, _ := gitConfigFiles(i.gitConfig); len(paths) > 0 {
+			c.Detail = "read " + strings.Join(paths, ", ")
+		}
+		checks = append(checks, c)
+	}
+
+	if config == nil {
+		checks = append(checks,
+			Check{Name: "identity", Status: CheckSkip, Detail: "needs the git config"},
+			Check{Name: "signing", Status: CheckSkip, Detail: "needs the git config"})
+	} else {
+		author := i.resolveAuthor(config)
+		checks = append(checks, i.checkIdentity(author), i.checkSigning(ctx, config, author))
+	}
+
+	checks = append(checks, i.checkTarget(dir), i.checkProvider(ctx))
+	return checks
+}
+
+func (i *Initializer) checkIdentity(author AuthorInfo) Check {
+	c := Check{Name: "identity", Status: CheckPass, Detail: fmt.Sprintf("%s <%s>", author.Name, author.Email)}
+	if !author.IsPlaceholder() {
+		return c
+	}
+	if i.allowPlaceholder {
+		c.Detail += ", a placeholder, which is allowed"
+		return c
+	}
+	c.Status = CheckFail
+	c.Detail = "no user.name and user.email configured"
+	c.Hint = "pass --author and --email, or --configure-git NAME EMAIL"
+	return c
+}
+
+func (i *Initializer) checkSigning(ctx context.Context, config *gitConfig, author AuthorInfo) Check {
+	signing, err := i.configureSigning(config, author)
+	if signing == nil && err == nil {
+		return Check{Name: "signing", Status: CheckSkip, Detail: "commits are not signed"}
+	}
+
+	var detail string
+	if err == nil {
+		detail, err = findSigningKey(ctx, signing)
+	}
+	if err != nil {
+		return Check{Name: "signing", Status: CheckFail, Detail: err.Error(),
+			Hint: "check user.signingkey and gpg.format, or pass --no-sign"}
+	}
+	return Check{Name: "signing", Status: CheckPass, Detail: detail}
+}
+
+// findSigningKey makes sure the key signing would use is there, and says
+// where it was found.
+func findSigningKey(ctx context.Context, signing *signingConfig) (string, error) {
+	switch s := signing.signer.(type) {
+	case nil:
+		// configureSigning loaded the secret key from the keyring already.
+		return "secret key found in the keyring", nil
+
+	case *gpgSigner:
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, s.program, "--batch", "--list-secret-keys", s.keyID)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			// gpg reports the reason last, after any setup it did.
+			lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+			return "", fmt.Errorf("%s has no secret key for %s: %s", s.program, s.keyID, lines[len(lines)-1])
+		}
+		return fmt.Sprintf("%s has a secret key for %s", s.program, s.keyID), nil
+
+	case *sshSigner:
+		literal := strings.TrimPrefix(s.signingKey, sshLiteralKeyPrefix)
+		if literal != s.signingKey || strings.HasPrefix(s.signingKey, "ssh-") {
+			return "public key given in user.signingkey, its private half has to be in ssh-agent", nil
+		}
+		path, cleanup, err := sshKeyFile(s.signingKey)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("ssh signing key: %v", err)
+		}
+		return "ssh signing key " + path + " found", nil
+
+	default:
+		return "signing program found", nil
+	}
+}
+
+// checkTarget makes sure dir is a directory that files can be written to.
+func (i *Initializer) checkTarget(dir string) Check {
+	c := Check{Name: "target", Status: CheckFail}
+	if i.fs != nil {
+		c.Status, c.Detail = CheckSkip, "not on disk"
+		return c
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	if !info.IsDir() {
+		c.Detail = dir + " is not a directory"
+		return c
+	}
+
+	f, err := os.CreateTemp(dir, ".greenleeks-doctor-*")
+	if err != nil {
+		c.Detail = err.Error()
+		c.Hint = "run as the owner of " + dir + ", or fix its permissions"
+		return c
+	}
+	f.Close()
+	_ = os.Remove(f.Name())
+
+	c.Status, c.Detail = CheckPass, dir+" is writable"
+	if isUnderGit, err := IsUnderGitControl(dir); err == nil && isUnderGit {
+		c.Detail += ", but already a repository, which init leaves alone"
+	}
+	return c
+}
+
+func (i *Initializer) checkProvider(ctx context.Context) Check {
+	c := Check{Name: "provider", Status: CheckSkip, Detail: "no provider configured"}
+	provider := i.provider
+	if limited, ok := provider.(*rateLimitedProvider); ok {
+		provider = limited.Provider
+	}
+	checker, ok := provider.(userChecker)
+	switch {
+	case i.provider == nil:
+		return c
+	case !ok:
+		c.Detail = "the provider cannot check its token"
+		return c
+	}
+
+	login, err := checker.currentUser(ctx)
+	if err != nil {
+		c.Status, c.Detail = CheckFail, err.Error()
+		c.Hint = "check --provider-url and --provider-token"
+		return c
+	}
+	c.Status, c.Detail = CheckPass, "token belongs to "+login
+	return c
+}
+
+// runDoctor prints the Doctor checks for the given directory, or --root,
+// and fails if any of them did.
+func runDoctor() error {
+	dir := opts.RootDir
+	switch len(opts.args) {
+	case 0:
+	case 1:
+		dir = opts.args[0]
+	default:
+		return fmt.Errorf("doctor takes at most one directory, got %d", len(opts.args))
+	}
+
+	options, err := cliOptions()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	checks := New(options...).Doctor(ctx, dir)
+
+	if opts.LogFormat == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(checks); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range checks {
+			color := colorGreen
+			switch c.Status {
+			case CheckFail:
+				color = colorRed
+			case CheckSkip:
+				color = colorYellow
+			}
+			fmt.Printf("%s  %-9s  %s\n", paint(color, fmt.Sprintf("%-4s", c.Status)), c.Name, c.Detail)
+			if c.Hint != "" {
+				fmt.Printf("%17s%s\n", "", c.Hint)
+			}
+		}
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if c.Status == CheckFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
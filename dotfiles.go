@@ -0,0 +1,243 @@
+package greenleeks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/jessevdk/go-flags"
+)
+
+const dotfilesGitDir = ".dotfiles.git"
+
+// DefaultDotfiles is what WithDotfiles commits when given no paths.
+// Directories are committed with everything in them.
+var DefaultDotfiles = []string{
+	".bash_profile",
+	".bashrc",
+	// Not all of .config/git, which can hold the plaintext tokens of
+	// git-credential-store in credentials.
+	".config/git/attributes",
+	".config/git/config",
+	".config/git/ignore",
+	".config/nvim",
+	".gitconfig",
+	".inputrc",
+	".profile",
+	".tmux.conf",
+	".vimrc",
+	".zprofile",
+	".zshrc",
+}
+
+// runDotfiles creates a repository outside fs with fs as its work tree
+// and commits the allowlisted dotfiles. Nothing is written into fs itself,
+// so the home directory does not turn into a repository for every
+// directory below it.
+func (i *Initializer) runDotfiles(ctx context.Context, fs billy.Filesystem, rs *runState) (*Result, error) {
+	if i.bare {
+		return nil, errors.New("dotfiles mode cannot be combined with a bare repository")
+	}
+	if i.excludeHidden {
+		return nil, errors.New("dotfiles mode cannot be combined with excluding hidden files")
+	}
+	if i.scaffoldReadme || i.gitattributes || i.keepEmptyDirs || i.license != "" || i.fromTemplate != "" {
+		return nil, errors.New("dotfiles mode cannot be combined with scaffolding")
+	}
+
+	endScan := i.startPhase(ctx, "scan", &rs.phases.Scan)
+	files, droppedBinaries, err := i.dotfileList(ctx, fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dotfiles: %w", err)
+	}
+	endScan()
+
+	if len(droppedBinaries) > 0 {
+		i.logger.Info("Left out binary files.", "files", len(droppedBinaries), "examples", logExamples(droppedBinaries))
+	}
+	rs.addBinaries(files)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("none of %s exist in %s", strings.Join(i.dotfiles, ", "), rs.dir)
+	}
+
+	if err := i.checkFileLimit(len(files)); err != nil {
+		return nil, err
+	}
+
+	worktreePath := fs.Root()
+	if i.fs == nil {
+		worktreePath, err = filepath.Abs(worktreePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dot, err := i.gitDirFilesystem(fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git directory: %w", err)
+	}
+
+	err = rs.rollback.gitDir(dot)
+	if err != nil {
+		return nil, err
+	}
+
+	i.logger.Info("Initializing dotfiles repository...", "gitdir", dot.Root())
+
+	storage := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+
+	repo, err := git.Init(storage, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize git repository: %w", err)
+	}
+
+	err = i.setupGitDir(repo, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository config: %w", err)
+	}
+	cfg.Core.IsBare = false
+	cfg.Core.Worktree = worktreePath
+	// git only honours core.worktree under an explicit --git-dir when the
+	// format version is set, which go-git leaves out.
+	cfg.Core.RepositoryFormatVersion = format.Version_0
+	// Everything else in the home directory would otherwise show up as
+	// untracked.
+	cfg.Raw.Section("status").SetOption("showUntrackedFiles", "no")
+	err = repo.Storer.SetConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write repository config: %w", err)
+	}
+
+	repo, err = git.Open(storage, fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	i.emit(Event{Type: Staging, Dir: rs.dir, Files: len(files), Bytes: totalSize(files)})
+
+	// Staging the listed files directly, in one index write, keeps go-git
+	// from computing the status of the whole home directory.
+	endStage := i.startPhase(ctx, "stage", &rs.phases.Stage)
+	err = stageFiles(ctx, repo, fs, files, func(n int, bytes int64) {
+		i.emit(Event{Type: FilesStaged, Dir: rs.dir, Files: n, Bytes: bytes})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add files: %w", err)
+	}
+	endStage()
+
+	result, err := i.commitAndPublish(ctx, repo, rs, len(files), droppedBinaries)
+	if result != nil {
+		i.logger.Info("Use the repository with git --git-dir.", "gitdir", dot.Root(), "worktree", worktreePath)
+	}
+	return result, err
+}
+
+// dotfileList expands the allowlist into the files it names, sorted by
+// path, walking directories and leaving out anything WithExcludes matches.
+// Paths that do not exist are skipped, and a file named twice, directly
+// and through its directory, is listed once. Files are classified as
+// binary or not, and with WithNoBinaries the binary ones are returned
+// apart, sorted.
+func (i *Initializer) dotfileList(ctx context.Context, fs billy.Filesystem) ([]scannedFile, []string, error) {
+	matcher := gitignore.NewMatcher(i.excludePatterns())
+
+	seen := make(map[string]bool)
+	var files []scannedFile
+	var droppedBinaries []string
+	for _, entry := range i.dotfiles {
+		entry = filepath.FromSlash(entry)
+
+		if _, err := fs.Lstat(entry); os.IsNotExist(err) {
+			i.logger.Debug("skipping missing dotfile", "path", filepath.ToSlash(entry))
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		err := util.Walk(fs, entry, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if matcher.Match(strings.Split(path, string(filepath.Separator)), info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				if info.Name() == git.GitDirName {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if seen[path] {
+				return nil
+			}
+			seen[path] = true
+
+			binary := false
+			if info.Mode().IsRegular() {
+				binary, err = isBinaryFile(fs, path)
+				if err != nil {
+					return err
+				}
+			}
+			if binary && i.noBinaries {
+				droppedBinaries = append(droppedBinaries, filepath.ToSlash(path))
+				return nil
+			}
+			files = append(files, scannedFile{path: path, info: info, binary: binary})
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sort.Slice(files, func(a, b int) bool {
+		return filepath.ToSlash(files[a].path) < filepath.ToSlash(files[b].path)
+	})
+	sort.Strings(droppedBinaries)
+	return files, droppedBinaries, nil
+}
+
+// dotfilesRoot points --root at the home directory for --dotfiles, unless
+// a root was given on the command line, in the environment or in a config
+// file.
+func dotfilesRoot(parser *flags.Parser) error {
+	root := parser.FindOptionByLongName("root")
+	if root.IsSet() && !root.IsSetDefault() {
+		return nil
+	}
+	if _, ok := os.LookupEnv(root.EnvKeyWithNamespace()); ok {
+		return nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	opts.RootDir = home
+	return nil
+}
@@ -0,0 +1,50 @@
+package greenleeks
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrAlreadyUnderGit is returned by Run when the directory already has
+	// a .git of its own. Repositories further up are not looked for.
+	ErrAlreadyUnderGit = errors.New("directory is already under git control")
+	// ErrTooManyFiles is returned by Run when the directory holds more files
+	// than WithMaxFiles allows. The concrete error is a *TooManyFilesError.
+	ErrTooManyFiles = errors.New("too many files")
+	// ErrNoIdentity is returned by Run when no author identity could be
+	// resolved and WithAllowPlaceholderIdentity was not given.
+	ErrNoIdentity = errors.New("no git identity configured")
+	// ErrNothingToCommit is returned by Run when there is nothing to put in
+	// the initial commit and WithAllowEmpty was not given.
+	ErrNothingToCommit = errors.New("nothing to commit")
+	// ErrScanTimeout is returned by Run and Plan when walking the directory
+	// takes longer than WithScanTimeout allows.
+	ErrScanTimeout = errors.New("scan timed out")
+	// ErrNestedRepository is returned by Run when a subdirectory holds a
+	// repository of its own and WithNestedRepos is NestedReposAbort.
+	ErrNestedRepository = errors.New("nested repository")
+	// ErrNotUndoable is returned by Undo when the repository was not
+	// created by Run or has changed since.
+	ErrNotUndoable = errors.New("cannot undo")
+	// ErrHasRemote is returned by Adopt when the repository already has a
+	// remote.
+	ErrHasRemote = errors.New("repository already has a remote")
+	// ErrInProgress is returned by Run when another run, in this process
+	// or another, is working on the same directory.
+	ErrInProgress = errors.New("another greenleeks run is already in progress")
+)
+
+// TooManyFilesError reports how far over the limit a directory is.
+type TooManyFilesError struct {
+	Count int
+	Limit int
+}
+
+func (e *TooManyFilesError) Error() string {
+	return fmt.Sprintf(maxFilesErrorMessage, e.Count, e.Limit)
+}
+
+func (e *TooManyFilesError) Is(target error) bool {
+	return target == ErrTooManyFiles
+}
@@ -0,0 +1,124 @@
+package greenleeks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// forgejoProvider talks to the Forgejo API, which Gitea shares.
+type forgejoProvider struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewForgejoProvider returns a Provider for a Forgejo or Gitea instance at
+// baseURL, authenticating with an API token.
+func NewForgejoProvider(baseURL, token string) (Provider, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("forgejo provider requires a base url")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("forgejo provider requires a token")
+	}
+
+	return &forgejoProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (p *forgejoProvider) CreateRepository(ctx context.Context, name string, private bool) (*RemoteRepository, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"name":    name,
+		"private": private,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/v1/user/repos", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("forgejo: %w", &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Message:    strings.TrimSpace(string(msg)),
+			RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+		})
+	}
+
+	var created struct {
+		CloneURL string `json:"clone_url"`
+		Owner    struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return nil, fmt.Errorf("failed to decode forgejo response: %v", err)
+	}
+
+	return &RemoteRepository{
+		CloneURL: created.CloneURL,
+		Auth: &githttp.BasicAuth{
+			Username: created.Owner.Login,
+			Password: p.token,
+		},
+		RateLimit: parseRateLimit(resp.Header),
+	}, nil
+}
+
+// currentUser returns the login the token belongs to.
+func (p *forgejoProvider) currentUser(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/v1/user", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "token "+p.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("forgejo: %w", &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Message:    strings.TrimSpace(string(msg)),
+		})
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return "", fmt.Errorf("failed to decode forgejo response: %v", err)
+	}
+	return user.Login, nil
+}
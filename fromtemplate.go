@@ -0,0 +1,151 @@
+package greenleeks
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// TemplateData holds the variables substituted into the names and
+// contents of --from-template files, e.g. {{.ProjectName}}.
+type TemplateData struct {
+	ProjectName string
+	Author      string
+	Email       string
+	Year        int
+	Date        string
+}
+
+func newTemplateData(dir string, author AuthorInfo, now time.Time) TemplateData {
+	return TemplateData{
+		ProjectName: projectName(dir),
+		Author:      author.Name,
+		Email:       author.Email,
+		Year:        now.Year(),
+		Date:        now.Format("2006-01-02"),
+	}
+}
+
+// remoteTemplateFiles shallow-clones url into memory and returns the files
+// of its HEAD tree, without history, with data substituted into their
+// names and contents. A "#ref" suffix selects a branch. Files that already
+// exist in fs are left out so that they are not overwritten.
+func (i *Initializer) remoteTemplateFiles(ctx context.Context, fs billy.Filesystem, url string, data TemplateData) ([]scaffoldFile, error) {
+	cloneOptions := &git.CloneOptions{
+		URL:          url,
+		Depth:        1,
+		SingleBranch: true,
+		NoCheckout:   true,
+		Tags:         git.NoTags,
+	}
+	if base, ref, ok := strings.Cut(url, "#"); ok {
+		cloneOptions.URL = base
+		cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(ref)
+	}
+
+	i.logger.Info("fetching template", "url", url)
+
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), nil, cloneOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []scaffoldFile
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if f.Mode != filemode.Regular && f.Mode != filemode.Executable && f.Mode != filemode.Symlink {
+			i.logger.Warn("skipping template entry that is not a file", "path", f.Name, "mode", f.Mode)
+			return nil
+		}
+
+		name := i.renderTemplate(f.Name, f.Name, data)
+
+		if _, err := fs.Lstat(name); err == nil {
+			i.logger.Info("keeping existing file over template", "path", name)
+			return nil
+		}
+
+		content, err := fileContents(f)
+		if err != nil {
+			return err
+		}
+		if f.Mode != filemode.Symlink && !isBinary(content) {
+			content = []byte(i.renderTemplate(f.Name, string(content), data))
+		}
+
+		mode, err := f.Mode.ToOSFileMode()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, scaffoldFile{path: name, content: content, mode: mode})
+		return nil
+	})
+
+	return files, err
+}
+
+func fileContents(f *object.File) ([]byte, error) {
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// renderTemplate executes text as a Go template with data. Template
+// repositories often hold files that use {{ }} for something else, such
+// as CI workflows, so anything that fails to parse or execute is kept
+// verbatim.
+func (i *Initializer) renderTemplate(name, text string, data TemplateData) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		i.logger.Debug("not substituting template variables", "path", name, "error", err)
+		return text
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		i.logger.Debug("not substituting template variables", "path", name, "error", err)
+		return text
+	}
+
+	return buf.String()
+}
+
+// isBinary uses git's heuristic: a NUL byte in the first 8000 bytes.
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
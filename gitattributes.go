@@ -0,0 +1,201 @@
+package greenleeks
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+// gitattributesContent is the .gitattributes WithGitattributes writes.
+const gitattributesContent = `# Let git decide what is text and store it with LF line endings.
+* text=auto
+
+# Scripts that only work with their native line endings.
+*.sh   text eol=lf
+*.bash text eol=lf
+*.bat  text eol=crlf
+*.cmd  text eol=crlf
+
+# Never convert or diff these.
+*.png   binary
+*.jpg   binary
+*.jpeg  binary
+*.gif   binary
+*.ico   binary
+*.webp  binary
+*.pdf   binary
+*.zip   binary
+*.gz    binary
+*.tar   binary
+*.7z    binary
+*.jar   binary
+*.exe   binary
+*.dll   binary
+*.so    binary
+*.dylib binary
+*.woff  binary
+*.woff2 binary
+*.ttf   binary
+*.otf   binary
+*.eot   binary
+`
+
+// gitattributesBinary lists the extensions gitattributesContent marks as
+// binary.
+var gitattributesBinary = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".ico": true, ".webp": true,
+	".pdf": true, ".zip": true, ".gz": true, ".tar": true, ".7z": true, ".jar": true,
+	".exe": true, ".dll": true, ".so": true, ".dylib": true, ".woff": true, ".woff2": true,
+	".ttf": true, ".otf": true, ".eot": true,
+}
+
+// gitattributesScaffold returns the .gitattributes scaffold file, or nil if fs
+// or the template already has one.
+func gitattributesScaffold(fs billy.Filesystem, pending []scaffoldFile) (*scaffoldFile, error) {
+	exists, err := hasTopLevelFile(fs, pending, strings.ToUpper(gitattributesFile))
+	if err != nil || exists {
+		return nil, err
+	}
+	return &scaffoldFile{path: gitattributesFile, content: []byte(gitattributesContent)}, nil
+}
+
+// normalizeLineEndings stages the text files that have CRLF line endings
+// with LF instead, which is what git add does under "* text=auto" and
+// go-git does not. Files git would consider binary, for a NUL byte or a
+// lone CR, are left alone, as are the extensions marked binary.
+func (i *Initializer) normalizeLineEndings(ctx context.Context, fs billy.Filesystem, repo *git.Repository) error {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	var normalized []string
+	for _, e := range idx.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if e.Mode != filemode.Regular && e.Mode != filemode.Executable {
+			continue
+		}
+		if gitattributesBinary[strings.ToLower(path.Ext(e.Name))] {
+			continue
+		}
+
+		binary, err := isBinaryFile(fs, e.Name)
+		if err != nil {
+			return err
+		}
+		if binary {
+			continue
+		}
+
+		size, crlf, loneCR, err := scanLineEndings(fs, e.Name)
+		if err != nil {
+			return err
+		}
+		if crlf == 0 || loneCR {
+			continue
+		}
+
+		// The entry keeps the stat data, size included, of the file in the
+		// work tree, as git's does; only the blob differs. With no lone CR
+		// in the file, dropping every CR is the same as turning CRLF into LF.
+		f, err := fs.Open(e.Name)
+		if err != nil {
+			return err
+		}
+		e.Hash, err = streamBlob(repo, crDropper{f}, size-crlf)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, e.Name)
+	}
+
+	if len(normalized) == 0 {
+		return nil
+	}
+
+	i.logger.Info("Normalized CRLF line endings.", "files", len(normalized), "examples", logExamples(normalized))
+	return repo.Storer.SetIndex(idx)
+}
+
+// scanLineEndings reads name through in constant memory and returns its
+// size, how many CRLF line endings it has and whether it has a CR that is
+// not followed by LF.
+func scanLineEndings(fs billy.Filesystem, name string) (size, crlf int64, loneCR bool, err error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 32*1024)
+	afterCR := false
+	for {
+		n, err := f.Read(buf)
+		for _, b := range buf[:n] {
+			if afterCR {
+				if b != '\n' {
+					return 0, 0, true, nil
+				}
+				crlf++
+			}
+			afterCR = b == '\r'
+		}
+		size += int64(n)
+		if err == io.EOF {
+			return size, crlf, afterCR, nil
+		}
+		if err != nil {
+			return 0, 0, false, err
+		}
+	}
+}
+
+// crDropper reads from r with every CR left out.
+type crDropper struct {
+	r io.Reader
+}
+
+func (d crDropper) Read(p []byte) (int, error) {
+	for {
+		n, err := d.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if b != '\r' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || n == 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// storeBlob writes data to repo as a blob.
+func storeBlob(repo *git.Repository, data []byte) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return repo.Storer.SetEncodedObject(obj)
+}
@@ -0,0 +1,470 @@
+package greenleeks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	mymazda "github.com/taylormonacelli/forestfish/mymazda"
+)
+
+// maxIncludeDepth matches git's own limit on nested include directives.
+const maxIncludeDepth = 10
+
+// gitConfig is a git configuration with include and includeIf directives
+// already expanded, so lookups see the same values git would.
+type gitConfig struct {
+	raw *format.Config
+}
+
+// get returns the last value of section[.subsection].key, like git config --get.
+func (c *gitConfig) get(section, subsection, key string) string {
+	if !c.raw.HasSection(section) {
+		return ""
+	}
+
+	s := c.raw.Section(section)
+	if subsection == "" {
+		return s.Options.Get(key)
+	}
+
+	if !s.HasSubsection(subsection) {
+		return ""
+	}
+
+	return s.Subsection(subsection).Options.Get(key)
+}
+
+// getBool interprets a value the way git does, where a key without a value
+// means true.
+func (c *gitConfig) getBool(section, subsection, key string, fallback bool) bool {
+	if !c.raw.HasSection(section) {
+		return fallback
+	}
+
+	s := c.raw.Section(section)
+	options := s.Options
+	if subsection != "" {
+		if !s.HasSubsection(subsection) {
+			return fallback
+		}
+		options = s.Subsection(subsection).Options
+	}
+
+	if !options.Has(key) {
+		return fallback
+	}
+
+	switch strings.ToLower(options.Get(key)) {
+	case "", "true", "yes", "on":
+		return true
+	case "false", "no", "off":
+		return false
+	default:
+		n, err := strconv.Atoi(options.Get(key))
+		if err != nil {
+			return fallback
+		}
+		return n != 0
+	}
+}
+
+// gitConfigFiles returns the config files to read, lowest precedence first:
+// the system config, then the global one. An explicit path replaces the
+// global lookup.
+func gitConfigFiles(explicit string) ([]string, error) {
+	paths := systemConfigFiles()
+
+	if explicit != "" {
+		path, err := mymazda.ExpandTilde(explicit)
+		if err != nil {
+			return nil, err
+		}
+		return append(paths, path), nil
+	}
+
+	global, err := globalConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(paths, global...), nil
+}
+
+// windowsSystemConfigPaths lists the system configs Git for Windows reads,
+// with getenv standing in for os.Getenv and root the installation git.exe
+// belongs to, if known.
+func windowsSystemConfigPaths(getenv func(string) string, root string) []string {
+	var paths []string
+
+	if programData := getenv("PROGRAMDATA"); programData != "" {
+		paths = append(paths, filepath.Join(programData, "Git", "config"))
+	}
+
+	if root != "" {
+		return append(paths,
+			filepath.Join(root, "etc", "gitconfig"),
+			filepath.Join(root, "mingw64", "etc", "gitconfig"),
+		)
+	}
+
+	if programFiles := getenv("ProgramFiles"); programFiles != "" {
+		paths = append(paths, filepath.Join(programFiles, "Git", "etc", "gitconfig"))
+	}
+
+	return paths
+}
+
+// gitInstallRoot walks up from dir, the directory of git.exe, which lives
+// in cmd\, bin\ or mingw64\bin\ of the installation.
+func gitInstallRoot(dir string) string {
+	for _, suffix := range []string{`\mingw64\bin`, `\cmd`, `\bin`} {
+		if strings.HasSuffix(strings.ToLower(dir), suffix) {
+			return dir[:len(dir)-len(suffix)]
+		}
+	}
+	return ""
+}
+
+// windowsHomeDir resolves home the way Git for Windows does, with getenv
+// standing in for os.Getenv: HOME first, then HOMEDRIVE+HOMEPATH, then
+// USERPROFILE. It returns "" if none are set.
+func windowsHomeDir(getenv func(string) string) string {
+	if home := getenv("HOME"); home != "" {
+		return home
+	}
+
+	if drive, path := getenv("HOMEDRIVE"), getenv("HOMEPATH"); drive != "" && path != "" {
+		return drive + path
+	}
+
+	return getenv("USERPROFILE")
+}
+
+// systemConfigFiles honors GIT_CONFIG_NOSYSTEM and GIT_CONFIG_SYSTEM.
+func systemConfigFiles() []string {
+	if noSystem, err := strconv.ParseBool(os.Getenv("GIT_CONFIG_NOSYSTEM")); err == nil && noSystem {
+		return nil
+	}
+
+	if env := os.Getenv("GIT_CONFIG_SYSTEM"); env != "" {
+		return existingFiles(env)
+	}
+
+	return existingFiles(systemGitConfigPaths()...)
+}
+
+// globalConfigFiles honors GIT_CONFIG_GLOBAL and otherwise follows git's
+// global lookup, where ~/.gitconfig overrides $XDG_CONFIG_HOME/git/config
+// and either may be missing.
+func globalConfigFiles() ([]string, error) {
+	if env := os.Getenv("GIT_CONFIG_GLOBAL"); env != "" {
+		return existingFiles(env), nil
+	}
+
+	home, err := gitHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	configHome, err := xdgConfigHome()
+	if err != nil {
+		return nil, err
+	}
+
+	return existingFiles(
+		filepath.Join(configHome, "git", "config"),
+		filepath.Join(home, gitConfigFileName),
+	), nil
+}
+
+// xdgConfigHome returns $XDG_CONFIG_HOME, defaulting to ~/.config on every
+// platform as git does.
+func xdgConfigHome() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := gitHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".config"), nil
+}
+
+// globalConfigWritePath picks the file git config --global would write to:
+// ~/.gitconfig, unless only the XDG file exists.
+func globalConfigWritePath(explicit string) (string, error) {
+	if explicit != "" {
+		return mymazda.ExpandTilde(explicit)
+	}
+
+	if env := os.Getenv("GIT_CONFIG_GLOBAL"); env != "" {
+		return env, nil
+	}
+
+	home, err := gitHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	global, err := globalConfigFiles()
+	if err != nil {
+		return "", err
+	}
+
+	if len(global) == 1 && filepath.Base(global[0]) != gitConfigFileName {
+		return global[0], nil
+	}
+
+	return filepath.Join(home, gitConfigFileName), nil
+}
+
+// appendGitConfigSection appends a section to the config file at path,
+// creating it if needed. Appending rather than re-encoding keeps the
+// user's comments and layout intact, and git lets the later values win.
+func appendGitConfigSection(path, section string, options [][2]string) error {
+	var b strings.Builder
+
+	if data, err := os.ReadFile(path); err == nil && len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "[%s]\n", section)
+	for _, option := range options {
+		fmt.Fprintf(&b, "\t%s = %s\n", option[0], quoteGitConfigValue(option[1]))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(b.String())
+	return err
+}
+
+func quoteGitConfigValue(value string) string {
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;\"\\") {
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		return `"` + r.Replace(value) + `"`
+	}
+	return value
+}
+
+func existingFiles(paths ...string) []string {
+	var existing []string
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			existing = append(existing, path)
+		}
+	}
+	return existing
+}
+
+// loadGitConfig reads paths in order, along with every file they include.
+// Conditional includes are evaluated against the repository that will be
+// created in targetDir.
+func loadGitConfig(paths []string, targetDir string) (*gitConfig, error) {
+	gitDir, err := filepath.Abs(filepath.Join(targetDir, ".git"))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &gitConfig{raw: format.New()}
+
+	for _, path := range paths {
+		if err := cfg.merge(path, gitDir, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+func (c *gitConfig) merge(path, gitDir string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("exceeded maximum include depth (%d) while including %s", maxIncludeDepth, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	file := format.New()
+	if err := format.NewDecoder(f).Decode(file); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	for _, section := range file.Sections {
+		for _, option := range section.Options {
+			c.raw.AddOption(section.Name, "", option.Key, option.Value)
+
+			if section.IsName("include") && option.IsKey("path") {
+				if err := c.mergeInclude(path, option.Value, gitDir, depth); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, subsection := range section.Subsections {
+			for _, option := range subsection.Options {
+				c.raw.AddOption(section.Name, subsection.Name, option.Key, option.Value)
+
+				if section.IsName("includeIf") && option.IsKey("path") && includeConditionMatches(subsection.Name, path, gitDir) {
+					if err := c.mergeInclude(path, option.Value, gitDir, depth); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// mergeInclude resolves an include path relative to the including file.
+// Like git, a missing include file is not an error.
+func (c *gitConfig) mergeInclude(from, include, gitDir string, depth int) error {
+	path, err := expandConfigPath(include, filepath.Dir(from))
+	if err != nil {
+		return err
+	}
+
+	err = c.merge(path, gitDir, depth+1)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func expandConfigPath(path, baseDir string) (string, error) {
+	if strings.HasPrefix(path, "~") {
+		return mymazda.ExpandTilde(path)
+	}
+
+	if !filepath.IsAbs(path) {
+		return filepath.Join(baseDir, path), nil
+	}
+
+	return path, nil
+}
+
+// includeConditionMatches evaluates an includeIf condition. Only gitdir,
+// gitdir/i and onbranch apply to a repository that does not exist yet;
+// anything else never matches.
+func includeConditionMatches(condition, from, gitDir string) bool {
+	kind, pattern, ok := strings.Cut(condition, ":")
+	if !ok {
+		return false
+	}
+
+	switch kind {
+	case "gitdir", "gitdir/i":
+		return gitdirMatches(pattern, from, gitDir, kind == "gitdir/i")
+	case "onbranch":
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		return wildmatch(pattern, plumbing.Master.Short(), false)
+	default:
+		return false
+	}
+}
+
+func gitdirMatches(pattern, from, gitDir string, foldCase bool) bool {
+	switch {
+	case strings.HasPrefix(pattern, "~/"):
+		expanded, err := mymazda.ExpandTilde(pattern)
+		if err != nil {
+			return false
+		}
+		pattern = expanded
+	case strings.HasPrefix(pattern, "./"):
+		pattern = filepath.Join(filepath.Dir(from), pattern[2:])
+	}
+
+	pattern = filepath.ToSlash(pattern)
+	if !strings.HasPrefix(pattern, "/") && !filepath.IsAbs(pattern) {
+		pattern = "**/" + pattern
+	}
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	candidates := []string{gitDir}
+	if resolved, err := filepath.EvalSymlinks(filepath.Dir(gitDir)); err == nil {
+		candidates = append(candidates, filepath.Join(resolved, ".git"))
+	}
+
+	for _, candidate := range candidates {
+		if wildmatch(pattern, filepath.ToSlash(candidate), foldCase) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wildmatch implements the subset of git's wildmatch used by includeIf:
+// ** crosses directory boundaries, * and ? do not.
+func wildmatch(pattern, name string, foldCase bool) bool {
+	var expr strings.Builder
+
+	if foldCase {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(name)
+}
@@ -0,0 +1,169 @@
+package greenleeks
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// env returns a getenv over vars.
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestWindowsHomeDir(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "HOME wins",
+			env:  map[string]string{"HOME": `D:\home`, "HOMEDRIVE": "C:", "HOMEPATH": `\Users\me`, "USERPROFILE": `C:\Users\me`},
+			want: `D:\home`,
+		},
+		{
+			name: "HOMEDRIVE and HOMEPATH before USERPROFILE",
+			env:  map[string]string{"HOMEDRIVE": "H:", "HOMEPATH": `\me`, "USERPROFILE": `C:\Users\me`},
+			want: `H:\me`,
+		},
+		{
+			name: "HOMEDRIVE without HOMEPATH",
+			env:  map[string]string{"HOMEDRIVE": "H:", "USERPROFILE": `C:\Users\me`},
+			want: `C:\Users\me`,
+		},
+		{
+			name: "HOMEPATH without HOMEDRIVE",
+			env:  map[string]string{"HOMEPATH": `\me`, "USERPROFILE": `C:\Users\me`},
+			want: `C:\Users\me`,
+		},
+		{
+			name: "USERPROFILE",
+			env:  map[string]string{"USERPROFILE": `C:\Users\me`},
+			want: `C:\Users\me`,
+		},
+		{
+			name: "nothing set",
+			env:  map[string]string{},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := windowsHomeDir(env(tt.env)); got != tt.want {
+				t.Errorf("windowsHomeDir = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowsSystemConfigPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		root string
+		want []string
+	}{
+		{
+			name: "installation found",
+			env:  map[string]string{"PROGRAMDATA": "ProgramData", "ProgramFiles": "Program Files"},
+			root: "PortableGit",
+			want: []string{
+				filepath.Join("ProgramData", "Git", "config"),
+				filepath.Join("PortableGit", "etc", "gitconfig"),
+				filepath.Join("PortableGit", "mingw64", "etc", "gitconfig"),
+			},
+		},
+		{
+			name: "falls back to Program Files",
+			env:  map[string]string{"PROGRAMDATA": "ProgramData", "ProgramFiles": "Program Files"},
+			want: []string{
+				filepath.Join("ProgramData", "Git", "config"),
+				filepath.Join("Program Files", "Git", "etc", "gitconfig"),
+			},
+		},
+		{
+			name: "no PROGRAMDATA",
+			env:  map[string]string{"ProgramFiles": "Program Files"},
+			want: []string{filepath.Join("Program Files", "Git", "etc", "gitconfig")},
+		},
+		{
+			name: "nothing known",
+			env:  map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := windowsSystemConfigPaths(env(tt.env), tt.root)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("windowsSystemConfigPaths = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitInstallRoot(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{`C:\Program Files\Git\cmd`, `C:\Program Files\Git`},
+		{`C:\Program Files\Git\bin`, `C:\Program Files\Git`},
+		{`C:\Program Files\Git\mingw64\bin`, `C:\Program Files\Git`},
+		{`D:\Tools\PortableGit\CMD`, `D:\Tools\PortableGit`},
+		{`C:\Windows\System32`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := gitInstallRoot(tt.dir); got != tt.want {
+			t.Errorf("gitInstallRoot(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestSystemConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "gitconfig")
+	if err := os.WriteFile(existing, []byte("[user]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "GIT_CONFIG_SYSTEM",
+			env:  map[string]string{"GIT_CONFIG_SYSTEM": existing},
+			want: []string{existing},
+		},
+		{
+			name: "GIT_CONFIG_SYSTEM missing",
+			env:  map[string]string{"GIT_CONFIG_SYSTEM": filepath.Join(dir, "missing")},
+		},
+		{
+			name: "GIT_CONFIG_NOSYSTEM wins",
+			env:  map[string]string{"GIT_CONFIG_NOSYSTEM": "1", "GIT_CONFIG_SYSTEM": existing},
+		},
+		{
+			name: "GIT_CONFIG_NOSYSTEM false",
+			env:  map[string]string{"GIT_CONFIG_NOSYSTEM": "false", "GIT_CONFIG_SYSTEM": existing},
+			want: []string{existing},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"GIT_CONFIG_NOSYSTEM", "GIT_CONFIG_SYSTEM"} {
+				t.Setenv(key, tt.env[key])
+			}
+			if got := systemConfigFiles(); !slices.Equal(got, tt.want) {
+				t.Errorf("systemConfigFiles = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package greenleeks
+
+import "os"
+
+// systemGitConfigPaths returns the system-wide config of a git built with
+// the usual /usr prefix.
+func systemGitConfigPaths() []string {
+	return []string{"/etc/gitconfig"}
+}
+
+func gitHomeDir() (string, error) {
+	return os.UserHomeDir()
+}
@@ -0,0 +1,28 @@
+//go:build windows
+
+package greenleeks
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// systemGitConfigPaths mirrors Git for Windows, which reads
+// %PROGRAMDATA%\Git\config before the etc\gitconfig of the installation
+// that git.exe belongs to, including portable installs found on PATH.
+func systemGitConfigPaths() []string {
+	root := ""
+	if gitExe, err := exec.LookPath("git"); err == nil {
+		root = gitInstallRoot(filepath.Dir(gitExe))
+	}
+	return windowsSystemConfigPaths(os.Getenv, root)
+}
+
+// gitHomeDir resolves home the way Git for Windows does.
+func gitHomeDir() (string, error) {
+	if home := windowsHomeDir(os.Getenv); home != "" {
+		return home, nil
+	}
+	return os.UserHomeDir()
+}
@@ -0,0 +1,70 @@
+package greenleeks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+const gitkeepFile = ".gitkeep"
+
+// gitkeepFiles returns a .gitkeep for every directory in fs that has
+// nothing in it and will not get anything from the pending scaffold
+// files, since git only tracks directories through their files. Ignored
+// directories, and those whose .gitkeep WithMaxDepth would cut off, are
+// left alone.
+func (i *Initializer) gitkeepFiles(ctx context.Context, fs billy.Filesystem, pending []scaffoldFile) ([]scaffoldFile, error) {
+	patterns, err := gitignore.ReadPatterns(fs, nil)
+	if err != nil {
+		return nil, err
+	}
+	matcher := gitignore.NewMatcher(append(patterns, i.excludePatterns()...))
+
+	filled := map[string]bool{}
+	for _, f := range pending {
+		for dir := filepath.Dir(f.path); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			filled[dir] = true
+		}
+	}
+
+	var files []scaffoldFile
+	err = util.Walk(fs, "", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == "" || !info.IsDir() {
+			return nil
+		}
+		parts := strings.Split(path, string(filepath.Separator))
+		if path == git.GitDirName || matcher.Match(parts, true) {
+			return filepath.SkipDir
+		}
+		// A .gitkeep here would be below WithMaxDepth and never committed.
+		if i.maxDepth > 0 && len(parts) >= i.maxDepth {
+			return filepath.SkipDir
+		}
+		if filled[path] {
+			return nil
+		}
+
+		entries, err := fs.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			files = append(files, scaffoldFile{path: filepath.Join(path, gitkeepFile)})
+		}
+		return nil
+	})
+
+	return files, err
+}
@@ -1,23 +1,39 @@
 package greenleeks
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/jessevdk/go-flags"
-	mymazda "github.com/taylormonacelli/forestfish/mymazda"
-	"gopkg.in/ini.v1"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
+	DefaultMaxFiles      = 100
+	DefaultCommitMessage = "Boilerplate"
+
 	maxFilesErrorMessage = "too many files (%d), limit is %d"
 	gitConfigFileName    = ".gitconfig"
 	gitConfigUserSection = "user"
+	placeholderName      = "Your Name"
+	placeholderEmail     = "your.email@example.com"
 )
 
 type AuthorInfo struct {
@@ -25,100 +41,698 @@ type AuthorInfo struct {
 	Email string
 }
 
-var authorInfo AuthorInfo
+// IsPlaceholder reports whether either field fell through to the
+// hardcoded defaults.
+func (ai AuthorInfo) IsPlaceholder() bool {
+	return ai.Name == placeholderName || ai.Email == placeholderEmail
+}
+
+// Initializer turns a plain directory into a git repository with a single
+// boilerplate commit. Create one with New.
+type Initializer struct {
+	maxFiles             int
+	unlimitedFiles       bool
+	message              string
+	excludes             []gitignore.Pattern
+	excludeHidden        bool
+	maxDepth             int
+	scanTimeout          time.Duration
+	retries              int
+	nestedRepoPolicy     NestedRepoPolicy
+	gitConfig            string
+	author               AuthorInfo
+	allowPlaceholder     bool
+	identityFallback     func(AuthorInfo) (AuthorInfo, error)
+	signMode             SignMode
+	signingKeyring       string
+	sshSigningKey        string
+	provider             Provider
+	private              bool
+	progress             func(Event)
+	logger               *slog.Logger
+	fs                   billy.Filesystem
+	scaffoldReadme       bool
+	gitattributes        bool
+	keepEmptyDirs        bool
+	license              string
+	template             string
+	hooks                string
+	noVerify             bool
+	hooksPath            string
+	lfs                  bool
+	lfsThreshold         int64
+	noBinaries           bool
+	symlinks             SymlinkPolicy
+	fromTemplate         string
+	bare                 bool
+	separateGitDir       string
+	dotfiles             []string
+	tag                  string
+	tagMessage           string
+	trailers             []trailer
+	signoff              bool
+	conventionalType     string
+	conventionalScope    bool
+	ignoreCommitTemplate bool
+	date                 time.Time
+	reproducible         bool
+	allowEmpty           bool
+	resume               bool
+	rerun                RerunMode
+	splitBy              SplitMode
+	firstCommit          []gitignore.Pattern
+}
+
+// New returns an Initializer configured by opts.
+func New(opts ...Option) *Initializer {
+	i := &Initializer{
+		maxFiles:         DefaultMaxFiles,
+		retries:          DefaultRetries,
+		message:          DefaultCommitMessage,
+		lfsThreshold:     DefaultLFSThreshold,
+		symlinks:         SymlinksKeep,
+		nestedRepoPolicy: NestedReposEmbed,
+		logger:           slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
 
-var opts struct {
-	LogFormat string `long:"log-format" choice:"text" choice:"json" default:"text" description:"Log format"`
-	Verbose   []bool `short:"v" long:"verbose" description:"Show verbose debug information, each -v bumps log level"`
-	RootDir   string `short:"r" long:"root" description:"Root directory" default:"."`
-	MaxFiles  int    `long:"max-files" description:"Maximum number of files allowed" default:"100"`
-	GitConfig string `long:"gitconfig" description:"Path to the Git configuration file" default:"~/.gitconfig"`
-	CommitMsg string `short:"m" long:"commit-message" description:"Commit message" default:"Boilerplate"`
-	logLevel  slog.Level
+	return i
 }
 
-func Execute() int {
-	if err := parseFlags(); err != nil {
-		return 1
+// Run initializes dir, stages everything in it and commits. A directory
+// that is already under git control is left alone and ErrAlreadyUnderGit
+// is returned.
+func (i *Initializer) Run(ctx context.Context, dir string) (result *Result, err error) {
+	start := time.Now()
+
+	ctx, span := tracer.Start(ctx, "greenleeks.Run", trace.WithAttributes(attribute.String("greenleeks.dir", dir)))
+	defer func() {
+		if errors.Is(err, ErrAlreadyUnderGit) {
+			span.SetAttributes(attribute.Bool("greenleeks.already_under_git", true))
+			endSpan(span, nil)
+			return
+		}
+		endSpan(span, err)
+	}()
+
+	config, err := i.readGitConfig(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git config: %w", err)
+	}
+
+	message, literal, err := i.baseMessage(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if !literal {
+		literal, err = i.checkMessage(message)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	authorDate, committerDate, err := i.commitDates()
+	if err != nil {
+		return nil, err
+	}
+
+	if i.tag != "" {
+		if err := plumbing.NewTagReferenceName(i.tag).Validate(); err != nil {
+			return nil, fmt.Errorf("invalid tag %q: %w", i.tag, err)
+		}
+	}
+
+	fs, err := i.filesystem(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+
+	// Held from before the check for .git until the commit.
+	if i.fs == nil {
+		unlock, err := lockDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	isUnderGit, err := isUnderGitControl(fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if directory is under git control: %w", err)
+	}
+
+	if err := i.validateRerun(); err != nil {
+		return nil, err
+	}
+
+	var reopened *git.Repository
+	rerun := RerunNone
+	if isUnderGit {
+		reopened, rerun, err = i.reopen(fs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if i.bare {
+		if err := checkBareUnderGit(fs); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only a run that is going to commit needs an identity, so a directory
+	// already under git control is reported before anyone is prompted.
+	authorInfo := i.resolveAuthor(config)
+
+	if authorInfo.IsPlaceholder() && i.identityFallback != nil {
+		authorInfo, err = i.identityFallback(authorInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure git user info: %w", err)
+		}
+	}
+
+	if authorInfo.IsPlaceholder() && !i.allowPlaceholder {
+		return nil, fmt.Errorf("%w: set user.name and user.email in the git config", ErrNoIdentity)
 	}
 
-	if err := setLogLevel(); err != nil {
-		return 1
+	committerInfo := resolveCommitter(config, authorInfo)
+
+	signing, err := i.configureSigning(config, authorInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure commit signing: %w", err)
 	}
 
-	if err := setupLogger(); err != nil {
-		return 1
+	templateDir, err := i.templateDir(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve template directory: %w", err)
 	}
 
-	if err := run(); err != nil {
-		slog.Error("run failed", "error", err)
-		return 1
+	hooksDir, err := i.hooksDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve hooks directory: %w", err)
 	}
 
-	return 0
+	if i.bare && i.separateGitDir != "" {
+		return nil, errors.New("a bare repository cannot have a separate git directory")
+	}
+
+	rs := &runState{
+		dir:            dir,
+		start:          start,
+		author:         authorInfo,
+		committer:      committerInfo,
+		signing:        signing,
+		templateDir:    templateDir,
+		hooksDir:       hooksDir,
+		message:        message,
+		literalMessage: literal,
+		reopened:       reopened,
+		rerun:          rerun,
+		binaries:       make(map[string]bool),
+
+		coreHooksPath: i.coreHooksPath(config),
+		authorDate:    authorDate,
+		committerDate: committerDate,
+	}
+
+	result, err = i.initialize(ctx, fs, rs)
+	if result == nil && err != nil {
+		rs.rollback.run(i.logger)
+	}
+	return result, err
 }
 
-func parseFlags() error {
-	parser := flags.NewParser(&opts, flags.Default)
-	parser.Usage = "[OPTIONS]"
-	_, err := parser.ParseArgs(os.Args)
-	return err
+// initialize creates the repository for fs the way rs and the options ask
+// and commits. Anything it writes is registered with rs.rollback first.
+func (i *Initializer) initialize(ctx context.Context, fs billy.Filesystem, rs *runState) (*Result, error) {
+	if i.dotfiles != nil {
+		return i.runDotfiles(ctx, fs, rs)
+	}
+
+	if i.bare {
+		return i.runBare(ctx, fs, rs)
+	}
+
+	dir := rs.dir
+	scaffold, err := i.scaffoldFiles(ctx, fs, dir, rs.author, rs.committerDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare scaffolding: %w", err)
+	}
+
+	if len(scaffold) == 0 && !i.allowEmpty {
+		entries, err := fs.ReadDir("")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("%w in empty directory %s", ErrNothingToCommit, dir)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(scaffold))
+	for _, f := range scaffold {
+		paths = append(paths, f.path)
+	}
+	err = rs.rollback.created(fs, paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = i.writeScaffold(fs, scaffold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write scaffolding: %w", err)
+	}
+
+	// The scan, and with it the file limit, comes before git init, so
+	// that a run refused for it creates no repository.
+	i.emit(Event{Type: ScanStarted, Dir: dir})
+	endScan := i.startPhase(ctx, "scan", &rs.phases.Scan)
+
+	s, err := i.worktreeScanner(fs, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	scanned, err := i.scan(ctx, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan files: %w", err)
+	}
+
+	nested, err := i.nestedRepos(fs, scanned.nested)
+	if err != nil {
+		return nil, err
+	}
+	files := mergeFiles(scanned.files, gitlinks(nested))
+	endScan()
+
+	if len(scanned.binaries) > 0 {
+		i.logger.Info("Left out binary files.", "files", len(scanned.binaries), "examples", logExamples(scanned.binaries))
+	}
+	rs.addBinaries(files)
+
+	repo := rs.reopened
+	if repo == nil {
+		repo, err = i.createRepository(fs, rs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if i.nestedRepoPolicy == NestedReposSubmodule && len(nested) > 0 {
+		err = rs.rollback.replaced(fs, gitmodulesFile)
+		if err != nil {
+			return nil, err
+		}
+		gitmodules, err := i.registerSubmodules(fs, repo, nested)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register submodules: %w", err)
+		}
+		if gitmodules != nil {
+			files = mergeFiles(files, []scannedFile{*gitmodules})
+		}
+	}
+
+	fileCount := len(files)
+
+	if len(scanned.cutOff) > 0 {
+		i.logger.Info("Leaving out what is below the depth limit.", "depth", i.maxDepth, "paths", len(scanned.cutOff))
+	}
+
+	i.emit(Event{Type: Staging, Dir: dir, Files: fileCount, Bytes: totalSize(files)})
+	endStage := i.startPhase(ctx, "stage", &rs.phases.Stage)
+
+	err = stageFiles(ctx, repo, fs, files, func(n int, bytes int64) {
+		i.emit(Event{Type: FilesStaged, Dir: dir, Files: n, Bytes: bytes})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add all files: %w", err)
+	}
+	endStage()
+
+	// Only the .gitattributes written here is known to say text=auto.
+	if hasScaffold(scaffold, gitattributesFile) {
+		err = i.normalizeLineEndings(ctx, fs, repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to normalize line endings: %w", err)
+		}
+	}
+
+	err = rs.rollback.replaced(fs, gitattributesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tracked, err := i.trackLFS(ctx, fs, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up Git LFS: %w", err)
+	}
+	// What is committed for these is a pointer, which is text.
+	for _, name := range tracked {
+		delete(rs.binaries, name)
+	}
+
+	if rs.rerun != RerunNone {
+		err = i.prepareRerun(repo, rs.rerun)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := i.commitAndPublish(ctx, repo, rs, fileCount, scanned.skipped)
+	if result != nil {
+		result.CutOff = scanned.cutOff
+		result.NestedRepos = scanned.nested
+	}
+	return result, err
 }
 
-func run() error {
-	var err error
+// createRepository creates the repository for the work tree fs and fills
+// its git directory.
+func (i *Initializer) createRepository(fs billy.Filesystem, rs *runState) (*git.Repository, error) {
+	dot, err := i.gitDirFilesystem(fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git directory: %w", err)
+	}
 
-	authorInfo, err = ConfigureGitUserInfo()
+	err = rs.rollback.gitDir(dot)
+	if err == nil && i.separateGitDir != "" {
+		err = rs.rollback.created(fs, git.GitDirName)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to configure git user info: %v", err)
+		return nil, err
 	}
 
-	isUnderGit, err := IsUnderGitControl(opts.RootDir)
+	i.logger.Info("Initializing git repository...", "dir", rs.dir)
+
+	repo, err := initRepository(fs, dot)
 	if err != nil {
-		return fmt.Errorf("failed to check if directory is under git control: %v", err)
+		return nil, fmt.Errorf("failed to initialize git repository: %w", err)
 	}
 
-	if isUnderGit {
-		slog.Info("Directory is already under git control.")
+	err = i.setupGitDir(repo, rs)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// fileLimit is the WithMaxFiles limit for a scanner, zero for none.
+func (i *Initializer) fileLimit() int {
+	if i.unlimitedFiles {
+		return 0
+	}
+	return i.maxFiles
+}
+
+// checkFileLimit returns a TooManyFilesError if n files are more than
+// WithMaxFiles allows.
+func (i *Initializer) checkFileLimit(n int) error {
+	if i.unlimitedFiles || n <= i.maxFiles {
 		return nil
 	}
+	return &TooManyFilesError{Count: n, Limit: i.maxFiles}
+}
+
+// maxLogExamples is how many paths a log line about many files names.
+const maxLogExamples = 5
 
-	slog.Info("Initializing git repository...")
+// logExamples names the first few of paths for a log line that counts
+// them, so that -vv stays readable on large trees.
+func logExamples(paths []string) string {
+	if len(paths) > maxLogExamples {
+		return strings.Join(paths[:maxLogExamples], ", ") + ", ..."
+	}
+	return strings.Join(paths, ", ")
+}
 
-	err = InitializeGitRepository(opts.RootDir)
+// worktreeScanner returns a scanner for fs with info/exclude going before
+// WithExcludes, as newScanner has it: that of the reopened repository, or
+// else the one the template directory will provide the new one with.
+func (i *Initializer) worktreeScanner(fs billy.Filesystem, rs *runState) (*scanner, error) {
+	var infoDir billy.Filesystem
+	switch {
+	case rs.reopened != nil:
+		infoDir = gitDir(rs.reopened)
+	case rs.templateDir != "":
+		infoDir = osfs.New(rs.templateDir)
+	}
+
+	var excludes []gitignore.Pattern
+	if infoDir != nil {
+		infoExclude, err := readInfoExclude(infoDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read info/exclude: %v", err)
+		}
+		excludes = infoExclude
+	}
+
+	return &scanner{
+		fs:           fs,
+		excludes:     append(excludes, i.excludes...),
+		limit:        i.fileLimit(),
+		maxDepth:     i.maxDepth,
+		skipLinks:    i.symlinks == SymlinksSkip,
+		skipHidden:   i.excludeHidden,
+		classify:     true,
+		skipBinaries: i.noBinaries,
+		found: func(path string, n int, bytes int64) {
+			i.emit(Event{Type: FileCounted, Dir: rs.dir, Path: path, Files: n, Bytes: bytes})
+		},
+	}, nil
+}
+
+// runState is what Run resolves before touching the directory, shared by
+// the regular, bare and dotfiles modes.
+type runState struct {
+	dir         string
+	start       time.Time
+	author      AuthorInfo
+	committer   AuthorInfo
+	signing     *signingConfig
+	templateDir string
+	hooksDir    string
+	message     string
+	// literalMessage is set for a message that is used as it is rather
+	// than rendered with MessageData.
+	literalMessage bool
+	// coreHooksPath is where the hooks run from, if not the hooks
+	// directory of the new repository.
+	coreHooksPath string
+	// authorDate and committerDate are the dates of the initial commit.
+	authorDate    time.Time
+	committerDate time.Time
+	// reopened is the existing repository WithResume or WithRerun
+	// commits in, if any.
+	reopened *git.Repository
+	// rerun is how WithRerun commits again in reopened, RerunNone if it
+	// has no commits yet.
+	rerun RerunMode
+	// binaries holds, with forward slashes, the staged files that git
+	// treats as binary, as the scan found them.
+	binaries map[string]bool
+	// rollback takes back what the run wrote if it fails.
+	rollback rollback
+	// phases is how long the parts of the run took so far.
+	phases Phases
+}
+
+// startPhase starts timing phase, in a span of its own. The returned
+// function records in d how long it took and logs it; a phase cut short by
+// an error goes unrecorded.
+func (i *Initializer) startPhase(ctx context.Context, phase string, d *time.Duration) func() {
+	start := time.Now()
+	_, span := tracer.Start(ctx, "greenleeks."+phase)
+	return func() {
+		*d = time.Since(start)
+		span.End()
+		i.logger.Debug("Phase done.", "phase", phase, "duration", *d)
+	}
+}
+
+// commitAndPublish commits what is staged in repo, tags the commit and
+// publishes it if configured. files is the number of files reported in
+// progress events, skipped what was left out before staging.
+func (i *Initializer) commitAndPublish(ctx context.Context, repo *git.Repository, rs *runState, files int, skipped []string) (*Result, error) {
+	message, err := i.commitMessage(repo, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	linksSkipped, err := i.applySymlinks(ctx, repo, rs)
 	if err != nil {
-		return fmt.Errorf("failed to initialize git repository: %v", err)
+		return nil, fmt.Errorf("failed to apply the symlink policy: %w", err)
 	}
 
-	fileCount, err := countFiles(opts.RootDir)
+	index, err := repo.Storer.Index()
 	if err != nil {
-		return fmt.Errorf("failed to count files: %v", err)
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	binaries := 0
+	for _, e := range index.Entries {
+		if rs.binaries[e.Name] {
+			binaries++
+		}
 	}
 
-	if fileCount > opts.MaxFiles {
-		return fmt.Errorf(maxFilesErrorMessage, fileCount, opts.MaxFiles)
+	// Everything may have been ignored.
+	if len(index.Entries) == 0 && !i.allowEmpty {
+		return nil, fmt.Errorf("%w in %s", ErrNothingToCommit, rs.dir)
 	}
 
-	err = AddAllFiles(opts.RootDir)
+	endCommit := i.startPhase(ctx, "commit", &rs.phases.Commit)
+
+	// A bare repository has no work tree for the hook to look at.
+	if !i.bare {
+		err = i.runPreCommit(ctx, repo, rs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hash, message, commits, err := i.commitAll(ctx, repo, rs, message, files)
 	if err != nil {
-		return fmt.Errorf("failed to add all files: %v", err)
+		return nil, fmt.Errorf("failed to commit: %w", err)
 	}
 
-	err = commit(opts.RootDir, opts.CommitMsg)
+	err = i.createTag(repo, hash, rs)
 	if err != nil {
-		return fmt.Errorf("failed to commit: %v", err)
+		return nil, err
 	}
 
-	slog.Info("Git initialization successful.")
+	err = recordCreation(repo, hash, i.tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record the initial commit: %w", err)
+	}
+	endCommit()
 
-	return nil
+	skipped = append(skipped[:len(skipped):len(skipped)], linksSkipped...)
+	sort.Strings(skipped)
+	result := &Result{CommitHash: hash.String(), Message: message, Commits: commits, Tag: i.tag, BinaryFiles: binaries, Skipped: skipped, FilesSkipped: len(skipped)}
+
+	err = describeCommit(repo, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read back commit: %w", err)
+	}
+
+	i.logger.Info("Git initialization successful.", "commit", result.ShortHash(), "branch", result.Branch)
+
+	if i.provider != nil {
+		endPush := i.startPhase(ctx, "push", &rs.phases.Push)
+		_, err = i.publish(ctx, repo, rs.dir, i.tag != "")
+		endPush()
+		if err != nil {
+			result.Duration, result.Phases = time.Since(rs.start), rs.phases
+			return result, fmt.Errorf("failed to publish: %w", err)
+		}
+	}
+
+	result.Duration, result.Phases = time.Since(rs.start), rs.phases
+
+	return result, nil
+}
+
+// filesystem returns the worktree for dir: a directory on disk, made
+// absolute so that absolute symlinks in it can be made relative to it,
+// or dir inside the filesystem given to WithFilesystem.
+func (i *Initializer) filesystem(dir string) (billy.Filesystem, error) {
+	if i.fs == nil {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		return osfs.New(abs), nil
+	}
+	return i.fs.Chroot(dir)
+}
+
+// gitDirFilesystem returns where the repository for the worktree fs is
+// stored: its .git directory, or the directory given to WithSeparateGitDir
+// or implied by WithDotfiles, which must not already hold a repository.
+func (i *Initializer) gitDirFilesystem(fs billy.Filesystem) (billy.Filesystem, error) {
+	var dot billy.Filesystem
+	switch {
+	case i.separateGitDir != "" && i.fs != nil:
+		chroot, err := i.fs.Chroot(i.separateGitDir)
+		if err != nil {
+			return nil, err
+		}
+		dot = chroot
+	case i.separateGitDir != "":
+		abs, err := filepath.Abs(i.separateGitDir)
+		if err != nil {
+			return nil, err
+		}
+		dot = osfs.New(abs)
+	case i.dotfiles != nil:
+		chroot, err := fs.Chroot(dotfilesGitDir)
+		if err != nil {
+			return nil, err
+		}
+		dot = chroot
+	default:
+		return fs.Chroot(git.GitDirName)
+	}
+
+	_, err := git.Open(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), nil)
+	if err == nil {
+		return nil, fmt.Errorf("%s already holds a git repository", dot.Root())
+	}
+	if err != git.ErrRepositoryNotExists {
+		return nil, err
+	}
+
+	return dot, nil
+}
+
+func newStorage(fs billy.Filesystem) (*filesystem.Storage, error) {
+	dot, err := fs.Chroot(git.GitDirName)
+	if err != nil {
+		return nil, err
+	}
+	return filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), nil
+}
+
+func openRepository(fs billy.Filesystem) (*git.Repository, error) {
+	storage, err := newStorage(fs)
+	if err != nil {
+		return nil, err
+	}
+	return git.Open(storage, fs)
 }
 
 func IsUnderGitControl(rootDir string) (bool, error) {
-	_, err := git.PlainOpen(rootDir)
+	return isUnderGitControl(osfs.New(rootDir))
+}
+
+// isUnderGitControl treats a .git file, as left by git worktree add or
+// --separate-git-dir, as a repository without following it. Only fs itself
+// is looked at, never its parents, so a directory inside another work tree
+// gets a repository of its own.
+func isUnderGitControl(fs billy.Filesystem) (bool, error) {
+	info, err := fs.Lstat(git.GitDirName)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return true, nil
+	}
+
+	_, err = openRepository(fs)
 	if err == nil {
 		return true, nil
-	} else if err == git.ErrRepositoryNotExists || err == git.ErrWorktreeNotProvided {
+	} else if err == git.ErrRepositoryNotExists {
 		return false, nil
 	} else {
 		return false, fmt.Errorf("failed to open repository: %v", err)
@@ -126,94 +740,189 @@ func IsUnderGitControl(rootDir string) (bool, error) {
 }
 
 func InitializeGitRepository(rootDir string) error {
-	_, err := git.PlainInit(rootDir, false)
+	return initializeGitRepository(osfs.New(rootDir))
+}
+
+func initializeGitRepository(fs billy.Filesystem) error {
+	dot, err := fs.Chroot(git.GitDirName)
 	if err != nil {
-		return fmt.Errorf("failed to initialize git repository: %v", err)
+		return err
 	}
-	return nil
+
+	_, err = initRepository(fs, dot)
+	return err
 }
 
-func AddAllFiles(rootDir string) error {
-	repo, err := git.PlainOpen(rootDir)
+// initRepository creates a repository stored in dot with fs as its
+// worktree.
+func initRepository(fs, dot billy.Filesystem) (*git.Repository, error) {
+	storage := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+
+	repo, err := git.Init(storage, fs)
 	if err != nil {
-		return fmt.Errorf("failed to open repository: %v", err)
+		return nil, fmt.Errorf("failed to initialize git repository: %v", err)
 	}
 
-	worktree, err := repo.Worktree()
+	if err := linkGitDir(repo, fs, dot); err != nil {
+		return nil, fmt.Errorf("failed to link git directory: %v", err)
+	}
+
+	return repo, nil
+}
+
+// linkGitDir rewrites the .git file and core.worktree go-git writes for a
+// separate git directory, and does nothing when .git is a directory.
+// go-git uses relative paths, which break as soon as either side is
+// mounted somewhere else; git init --separate-git-dir records the
+// absolute path and leaves core.worktree unset.
+func linkGitDir(repo *git.Repository, fs, dot billy.Filesystem) error {
+	if info, err := fs.Lstat(git.GitDirName); err != nil || info.IsDir() {
+		return err
+	}
+
+	err := util.WriteFile(fs, git.GitDirName, []byte("gitdir: "+dot.Root()+"\n"), 0o644)
 	if err != nil {
-		return fmt.Errorf("failed to get worktree: %v", err)
+		return err
 	}
 
-	_, err = worktree.Add(".")
+	cfg, err := repo.Config()
 	if err != nil {
-		return fmt.Errorf("failed to add all files: %v", err)
+		return err
 	}
+	cfg.Core.Worktree = ""
+	cfg.Raw.Section("core").RemoveOption("worktree")
+	return repo.Storer.SetConfig(cfg)
+}
 
-	return nil
+func AddAllFiles(ctx context.Context, rootDir string) error {
+	return addAllFiles(ctx, osfs.New(rootDir), nil)
 }
 
-func commit(rootDir, message string) error {
-	repo, err := git.PlainOpen(rootDir)
+// addAllFiles stages everything in fs that neither .gitignore nor excludes
+// match.
+func addAllFiles(ctx context.Context, fs billy.Filesystem, excludes []gitignore.Pattern) error {
+	repo, err := openRepository(fs)
 	if err != nil {
 		return fmt.Errorf("failed to open repository: %v", err)
 	}
 
-	worktree, err := repo.Worktree()
+	return stageAll(ctx, repo, excludes)
+}
+
+// stageAll stages everything in the worktree of repo that neither
+// .gitignore, info/exclude nor excludes match.
+func stageAll(ctx context.Context, repo *git.Repository, excludes []gitignore.Pattern) error {
+	s, err := newScanner(repo, excludes)
 	if err != nil {
-		return fmt.Errorf("failed to get worktree: %v", err)
+		return err
 	}
 
-	author := &object.Signature{
-		Name:  authorInfo.Name,
-		Email: authorInfo.Email,
-		When:  time.Now(),
+	scanned, err := s.scan(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to scan files: %v", err)
 	}
 
-	_, err = worktree.Commit(message, &git.CommitOptions{
-		Author: author,
-	})
+	err = stageFiles(ctx, repo, s.fs, scanned.files, nil)
 	if err != nil {
-		return fmt.Errorf("failed to commit: %v", err)
+		return fmt.Errorf("failed to add all files: %v", err)
 	}
 
-	return err
+	return nil
 }
 
-func countFiles(rootDir string) (int, error) {
-	fileCount := 0
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			fileCount++
-			if fileCount > opts.MaxFiles {
-				return fmt.Errorf(maxFilesErrorMessage, fileCount, opts.MaxFiles)
-			}
+// newScanner returns a scanner for the worktree of repo. go-git hides .git
+// from the worktree, so info/exclude, which a template may have provided,
+// is read here and goes before excludes.
+func newScanner(repo *git.Repository, excludes []gitignore.Pattern) (*scanner, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %v", err)
+	}
+
+	infoExclude, err := readInfoExclude(gitDir(repo))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read info/exclude: %v", err)
+	}
+
+	return &scanner{fs: worktree.Filesystem, excludes: append(infoExclude, excludes...)}, nil
+}
+
+// gitDir returns the filesystem holding the repository's git directory.
+func gitDir(repo *git.Repository) billy.Filesystem {
+	return repo.Storer.(*filesystem.Storage).Filesystem()
+}
+
+func readInfoExclude(dot billy.Filesystem) ([]gitignore.Pattern, error) {
+	f, err := dot.Open(dot.Join("info", "exclude"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []gitignore.Pattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
 		}
-		return nil
-	})
-	return fileCount, err
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+
+	return patterns, scanner.Err()
 }
 
-func ConfigureGitUserInfo() (AuthorInfo, error) {
-	gitConfigPath, err := mymazda.ExpandTilde(opts.GitConfig)
+func (i *Initializer) commit(ctx context.Context, repo *git.Repository, message string, rs *runState) (plumbing.Hash, error) {
+	if err := ctx.Err(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	worktree, err := repo.Worktree()
 	if err != nil {
-		panic(err)
+		return plumbing.ZeroHash, fmt.Errorf("failed to get worktree: %v", err)
 	}
 
-	ai := AuthorInfo{
-		Name:  "Your Name",
-		Email: "your.email@example.com",
+	author := &object.Signature{
+		Name:  rs.author.Name,
+		Email: rs.author.Email,
+		When:  rs.authorDate,
+	}
+
+	committer := &object.Signature{
+		Name:  rs.committer.Name,
+		Email: rs.committer.Email,
+		When:  rs.committerDate,
+	}
+
+	commitOptions := &git.CommitOptions{
+		Author:            author,
+		Committer:         committer,
+		AllowEmptyCommits: i.allowEmpty,
+		Amend:             rs.rerun == RerunAmend,
 	}
+	rs.signing.apply(commitOptions)
 
-	config, err := readGitConfig(gitConfigPath)
+	hash, err := worktree.Commit(message, commitOptions)
 	if err != nil {
-		return AuthorInfo{}, err
+		return plumbing.ZeroHash, fmt.Errorf("failed to commit: %v", err)
 	}
 
-	name := config.Section(gitConfigUserSection).Key("name").String()
-	email := config.Section(gitConfigUserSection).Key("email").String()
+	return hash, nil
+}
+
+// resolveAuthor layers the identity sources: the git config, then
+// GIT_AUTHOR_NAME/GIT_AUTHOR_EMAIL, then WithAuthor.
+func (i *Initializer) resolveAuthor(config *gitConfig) AuthorInfo {
+	ai := AuthorInfo{
+		Name:  placeholderName,
+		Email: placeholderEmail,
+	}
+
+	name := config.get(gitConfigUserSection, "", "name")
+	email := config.get(gitConfigUserSection, "", "email")
 
 	if name != "" {
 		ai.Name = name
@@ -223,11 +932,32 @@ func ConfigureGitUserInfo() (AuthorInfo, error) {
 		ai.Email = email
 	}
 
-	return ai, nil
+	if name := os.Getenv("GIT_AUTHOR_NAME"); name != "" {
+		ai.Name = name
+	}
+
+	if email := os.Getenv("GIT_AUTHOR_EMAIL"); email != "" {
+		ai.Email = email
+	}
+
+	if i.author.Name != "" {
+		ai.Name = i.author.Name
+	}
+
+	if i.author.Email != "" {
+		ai.Email = i.author.Email
+	}
+
+	return ai
 }
 
-func readGitConfig(gitConfigPath string) (*ini.File, error) {
-	cfg, err := ini.Load(gitConfigPath)
+func (i *Initializer) readGitConfig(dir string) (*gitConfig, error) {
+	paths, err := gitConfigFiles(i.gitConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadGitConfig(paths, dir)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,131 @@
+package greenleeks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+func TestRunOnMemfs(t *testing.T) {
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("HOME", t.TempDir())
+
+	fs := memfs.New()
+	files := map[string]string{
+		"project/README.md":    "hello\n",
+		"project/src/main.go":  "package main\n",
+		"project/build/out.o":  "object\n",
+		"project/.gitignore":   "build/\n",
+		"project/docs/a/b.txt": "deep\n",
+	}
+	for name, content := range files {
+		if err := util.WriteFile(fs, name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	i := New(
+		WithFilesystem(fs),
+		WithAuthor("Test", "test@example.com"),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	result, err := i.Run(context.Background(), "project")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.FilesAdded != 4 {
+		t.Errorf("FilesAdded = %d, want 4", result.FilesAdded)
+	}
+
+	worktree, err := fs.Chroot("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot, err := worktree.Chroot(git.GitDirName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git.Open(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), worktree)
+	if err != nil {
+		t.Fatalf("open the repository on memfs: %v", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash().String() != result.CommitHash {
+		t.Errorf("HEAD = %s, want %s", head.Hash(), result.CommitHash)
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var committed []string
+	err = tree.Files().ForEach(func(f *object.File) error {
+		committed = append(committed, f.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{".gitignore", "README.md", "docs/a/b.txt", "src/main.go"}
+	if !slices.Equal(committed, want) {
+		t.Errorf("committed %v, want %v", committed, want)
+	}
+
+	if _, err := i.Run(context.Background(), "project"); !errors.Is(err, ErrAlreadyUnderGit) {
+		t.Errorf("second Run: got %v, want ErrAlreadyUnderGit", err)
+	}
+}
+
+func TestRunAlreadyUnderGitWithoutIdentity(t *testing.T) {
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_AUTHOR_NAME", "")
+	t.Setenv("GIT_AUTHOR_EMAIL", "")
+
+	fs := memfs.New()
+	if err := util.WriteFile(fs, "project/README.md", []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	first := New(WithFilesystem(fs), WithAuthor("Test", "test@example.com"), WithLogger(logger))
+	if _, err := first.Run(context.Background(), "project"); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+
+	prompted := false
+	again := New(
+		WithFilesystem(fs),
+		WithLogger(logger),
+		WithIdentityFallback(func(ai AuthorInfo) (AuthorInfo, error) {
+			prompted = true
+			return ai, nil
+		}),
+	)
+	if _, err := again.Run(context.Background(), "project"); !errors.Is(err, ErrAlreadyUnderGit) {
+		t.Errorf("second Run: got %v, want ErrAlreadyUnderGit", err)
+	}
+	if prompted {
+		t.Error("second Run asked for an identity")
+	}
+}
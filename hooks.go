@@ -0,0 +1,140 @@
+package greenleeks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	mymazda "github.com/taylormonacelli/forestfish/mymazda"
+)
+
+const hooksDirName = "hooks"
+
+// setupGitDir fills the git directory of the new repository: the template
+// directory first, then the WithHooksDir hooks, which win over the
+// template's, then core.hooksPath from WithHooksPath.
+func (i *Initializer) setupGitDir(repo *git.Repository, rs *runState) error {
+	dot := gitDir(repo)
+	if rs.templateDir != "" {
+		err := i.copyTemplate(dot, rs.templateDir)
+		if err != nil {
+			return fmt.Errorf("failed to copy template %s: %w", rs.templateDir, err)
+		}
+	}
+
+	if rs.hooksDir != "" {
+		err := i.installHooks(dot, rs.hooksDir)
+		if err != nil {
+			return fmt.Errorf("failed to install hooks from %s: %w", rs.hooksDir, err)
+		}
+		if i.hooksPath != "" {
+			i.logger.Warn("git will not run the installed hooks, core.hooksPath points elsewhere", "hooksPath", i.hooksPath)
+		}
+	}
+
+	if i.hooksPath != "" {
+		cfg, err := repo.Config()
+		if err != nil {
+			return fmt.Errorf("failed to read repository config: %w", err)
+		}
+		cfg.Raw.Section("core").SetOption("hooksPath", i.hooksPath)
+		err = repo.Storer.SetConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to write repository config: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// coreHooksPath is the core.hooksPath the new repository ends up with:
+// WithHooksPath, which goes into its local config, else the one from the
+// global config.
+func (i *Initializer) coreHooksPath(config *gitConfig) string {
+	if i.hooksPath != "" {
+		return i.hooksPath
+	}
+	return config.get("core", "", "hookspath")
+}
+
+// hooksDir resolves WithHooksDir, checking that it is a directory before
+// anything is written.
+func (i *Initializer) hooksDir() (string, error) {
+	if i.hooks == "" {
+		return "", nil
+	}
+
+	dir, err := mymazda.ExpandTilde(i.hooks)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return dir, nil
+}
+
+// installHooks copies the files in hooksDir into dot's hooks directory as
+// executables, replacing any hook of the same name. Sample hooks and dot
+// files are left out, and subdirectories are not descended into, since
+// git only runs hooks at the top level.
+func (i *Initializer) installHooks(dot billy.Filesystem, hooksDir string) error {
+	src := osfs.New(hooksDir)
+
+	entries, err := src.ReadDir("")
+	if err != nil {
+		return err
+	}
+
+	err = dot.MkdirAll(hooksDirName, 0o755)
+	if err != nil {
+		return err
+	}
+
+	hooks, err := dot.Chroot(hooksDirName)
+	if err != nil {
+		return err
+	}
+
+	installed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".sample") {
+			continue
+		}
+
+		// Stat rather than the entry itself, so that symlinked hooks from a
+		// dotfiles checkout are copied too.
+		info, err := src.Stat(name)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		err = hooks.Remove(name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		i.logger.Debug("installing hook", "name", name)
+		err = copyFile(src, hooks, name, 0o755)
+		if err != nil {
+			return err
+		}
+		installed++
+	}
+
+	i.logger.Info("Installed hooks.", "count", installed, "from", hooksDir)
+	return nil
+}
@@ -0,0 +1,156 @@
+package greenleeks
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const gitConfigCommitterSection = "committer"
+
+var gitDateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// resolveCommitter resolves the committer the way git does: the author
+// identity, overridden by committer.name/committer.email from the git config,
+// overridden by GIT_COMMITTER_NAME/GIT_COMMITTER_EMAIL.
+func resolveCommitter(config *gitConfig, author AuthorInfo) AuthorInfo {
+	ci := author
+
+	if name := config.get(gitConfigCommitterSection, "", "name"); name != "" {
+		ci.Name = name
+	}
+
+	if email := config.get(gitConfigCommitterSection, "", "email"); email != "" {
+		ci.Email = email
+	}
+
+	if name := os.Getenv("GIT_COMMITTER_NAME"); name != "" {
+		ci.Name = name
+	}
+
+	if email := os.Getenv("GIT_COMMITTER_EMAIL"); email != "" {
+		ci.Email = email
+	}
+
+	return ci
+}
+
+// configureGitIdentity implements --configure-git: when no identity could be
+// resolved, the name and email given on the command line are written to the
+// global git config and used for this run.
+func configureGitIdentity(ai AuthorInfo, args []string) (AuthorInfo, error) {
+	if len(args) != 2 {
+		return ai, fmt.Errorf("--configure-git expects NAME and EMAIL arguments, got %d", len(args))
+	}
+
+	ai.Name, ai.Email = args[0], args[1]
+
+	path, err := globalConfigWritePath(opts.GitConfig)
+	if err != nil {
+		return ai, err
+	}
+
+	if err := writeIdentity(path, ai); err != nil {
+		return ai, err
+	}
+
+	slog.Info("wrote git identity", "path", path, "name", ai.Name, "email", ai.Email)
+
+	return ai, nil
+}
+
+// commitDates picks the author and committer dates of the initial
+// commit. WithDate wins, then GIT_AUTHOR_DATE and GIT_COMMITTER_DATE
+// respectively, then SOURCE_DATE_EPOCH, in UTC as reproducible builds
+// expect, and finally the current time. WithReproducible replaces the
+// current time with the Unix epoch and moves every date to UTC.
+func (i *Initializer) commitDates() (time.Time, time.Time, error) {
+	author, committer, err := i.configuredDates()
+	if err != nil || !i.reproducible {
+		return author, committer, err
+	}
+	return author.UTC(), committer.UTC(), nil
+}
+
+func (i *Initializer) configuredDates() (time.Time, time.Time, error) {
+	if !i.date.IsZero() {
+		return i.date, i.date, nil
+	}
+
+	fallback := time.Now()
+	if i.reproducible {
+		fallback = time.Unix(0, 0).UTC()
+	}
+	if value := os.Getenv("SOURCE_DATE_EPOCH"); value != "" {
+		seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", value)
+		}
+		fallback = time.Unix(seconds, 0).UTC()
+	}
+
+	author, err := envDate("GIT_AUTHOR_DATE", fallback)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	committer, err := envDate("GIT_COMMITTER_DATE", fallback)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return author, committer, nil
+}
+
+func envDate(name string, fallback time.Time) (time.Time, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	when, err := parseGitDate(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	return when, nil
+}
+
+// parseGitDate understands git's internal "<unix> <tz>" format (optionally
+// prefixed with @) plus the common RFC 2822 and ISO 8601 forms.
+func parseGitDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	fields := strings.Fields(strings.TrimPrefix(value, "@"))
+	if len(fields) >= 1 && len(fields) <= 2 {
+		if seconds, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			when := time.Unix(seconds, 0)
+			if len(fields) == 2 {
+				zone, err := time.Parse("-0700", fields[1])
+				if err != nil {
+					return time.Time{}, fmt.Errorf("invalid timezone %q", fields[1])
+				}
+				when = when.In(zone.Location())
+			}
+			return when, nil
+		}
+	}
+
+	for _, layout := range gitDateLayouts {
+		if when, err := time.Parse(layout, value); err == nil {
+			return when, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
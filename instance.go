@@ -0,0 +1,99 @@
+package greenleeks
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// takeoverTimeout is how long --takeover waits for the running watch to
+// stop.
+const takeoverTimeout = 10 * time.Second
+
+// lockWatch makes sure only one watch runs for parent, with a lock file in
+// the per-user lock directory holding the pid of the one that does. A
+// watch that died lets go of the lock by itself; one that is still running
+// is asked to stop with takeover, and refused otherwise.
+func lockWatch(parent string, takeover bool) (func(), error) {
+	path, err := lockPath("greenleeks-watch", parent)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := openLockFile(path, os.O_RDWR)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tryLock(f)
+	if errors.Is(err, errLocked) {
+		pid := readPid(f)
+		if !takeover {
+			f.Close()
+			return nil, fmt.Errorf("watch is already running for %s (pid %d), pass --takeover to replace it", parent, pid)
+		}
+		err = takeOver(f, pid)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+	}
+
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		_ = unlock(f)
+		f.Close()
+		return nil, fmt.Errorf("failed to write %s: %v", path, err)
+	}
+
+	return func() {
+		_ = f.Truncate(0)
+		_ = unlock(f)
+		f.Close()
+	}, nil
+}
+
+// takeOver stops the watch with pid, which holds the lock on f, and takes
+// the lock once it has let go.
+func takeOver(f *os.File, pid int) error {
+	if pid > 0 {
+		p, err := os.FindProcess(pid)
+		if err == nil {
+			slog.Info("Stopping the running watch.", "pid", pid)
+			err = stopProcess(p)
+		}
+		if err != nil {
+			slog.Warn("failed to stop the running watch", "pid", pid, "error", err)
+		}
+	}
+
+	deadline := time.Now().Add(takeoverTimeout)
+	for {
+		err := tryLock(f)
+		if !errors.Is(err, errLocked) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("watch (pid %d) did not stop within %s", pid, takeoverTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// readPid returns the pid in the lock file f, or 0.
+func readPid(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
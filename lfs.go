@@ -0,0 +1,300 @@
+package greenleeks
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// DefaultLFSThreshold is the size from which a file is considered for Git
+// LFS whatever its extension.
+const DefaultLFSThreshold = 10 << 20
+
+const (
+	gitattributesFile = ".gitattributes"
+	lfsAttributes     = "filter=lfs diff=lfs merge=lfs -text"
+	lfsPointerVersion = "https://git-lfs.github.com/spec/v1"
+
+	lfsPrePushHook = `#!/bin/sh
+command -v git-lfs >/dev/null 2>&1 || { printf >&2 "\n%s\n\n" "This repository is configured for Git LFS but 'git-lfs' was not found on your path."; exit 2; }
+git lfs pre-push "$@"
+`
+)
+
+// lfsExtensions are the kinds of file that belong in LFS at any size:
+// archives, media, design files and compiled binaries.
+var lfsExtensions = map[string]bool{
+	".7z": true, ".ai": true, ".avi": true, ".bin": true, ".dll": true, ".dmg": true,
+	".dylib": true, ".exe": true, ".flac": true, ".gz": true, ".iso": true, ".jar": true,
+	".mkv": true, ".mov": true, ".mp3": true, ".mp4": true, ".psd": true, ".rar": true,
+	".sketch": true, ".so": true, ".tar": true, ".tgz": true, ".war": true, ".wav": true,
+	".xz": true, ".zip": true,
+}
+
+// trackLFS looks through what is staged for files that belong in Git LFS.
+// Without WithLFS it only warns about them. With it, it does what git lfs
+// track and the clean filter would: .gitattributes gets a rule per
+// extension or oversized file, the contents go to .git/lfs/objects and
+// pointer files are staged in their place. The filter is configured in
+// the repository so that git lfs takes over from there. It returns the
+// files now staged as pointers.
+func (i *Initializer) trackLFS(ctx context.Context, fs billy.Filesystem, repo *git.Repository) ([]string, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	files, patterns, err := i.lfsCandidates(fs, idx.Entries)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	if !i.lfs {
+		i.logger.Warn("committing files that belong in Git LFS as regular blobs, consider --lfs",
+			"files", len(files), "examples", logExamples(files))
+		return nil, nil
+	}
+
+	i.logger.Info("Tracking files with Git LFS...", "files", len(files), "patterns", len(patterns))
+
+	err = writeGitattributes(fs, patterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", gitattributesFile, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	err = worktree.AddWithOptions(&git.AddOptions{Path: gitattributesFile, SkipStatus: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add %s: %v", gitattributesFile, err)
+	}
+
+	// Adding .gitattributes rewrote the index.
+	idx, err = repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	dot := gitDir(repo)
+	for _, name := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		e, err := idx.Entry(name)
+		if err != nil {
+			return nil, err
+		}
+
+		pointer, err := storeLFSObject(fs, dot, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store %s in Git LFS: %v", name, err)
+		}
+
+		// As with the clean filter, the entry keeps the size of the file in
+		// the work tree.
+		e.Hash, err = storeBlob(repo, pointer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.Storer.SetIndex(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	if i.provider != nil {
+		i.logger.Warn("LFS objects are not uploaded when publishing, run git lfs push --all origin")
+	}
+
+	if _, err := exec.LookPath("git-lfs"); err != nil {
+		i.logger.Warn("git-lfs is not installed, git will show the LFS files as modified until it is")
+	}
+
+	err = configureLFS(repo)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// lfsCandidates returns the staged files that belong in LFS, sorted, and
+// the .gitattributes patterns that cover them: *.ext for a known
+// extension, the anchored path for any other file of WithLFSThreshold
+// bytes or more.
+func (i *Initializer) lfsCandidates(fs billy.Filesystem, entries []*index.Entry) ([]string, []string, error) {
+	var files, patterns []string
+	seen := map[string]bool{}
+
+	for _, e := range entries {
+		if e.Mode != filemode.Regular && e.Mode != filemode.Executable {
+			continue
+		}
+
+		var pattern string
+		if ext := strings.ToLower(path.Ext(e.Name)); lfsExtensions[ext] {
+			pattern = "*" + ext
+		} else {
+			info, err := fs.Lstat(e.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if info.Size() < i.lfsThreshold {
+				continue
+			}
+			pattern = "/" + strings.ReplaceAll(e.Name, " ", "[[:space:]]")
+		}
+
+		files = append(files, e.Name)
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	sort.Strings(files)
+	sort.Strings(patterns)
+	return files, patterns, nil
+}
+
+// writeGitattributes adds an LFS rule for each pattern to .gitattributes,
+// leaving rules that are already there alone.
+func writeGitattributes(fs billy.Filesystem, patterns []string) error {
+	existing, err := readFile(fs, gitattributesFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(existing)
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	for _, pattern := range patterns {
+		line := pattern + " " + lfsAttributes
+		if bytes.Contains(existing, []byte(line)) {
+			continue
+		}
+		buf.WriteString(line + "\n")
+	}
+
+	f, err := fs.OpenFile(gitattributesFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readFile(fs billy.Filesystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// storeLFSObject copies name into dot's lfs/objects, under its SHA-256 as
+// the LFS clean filter does, and returns the pointer file for it.
+func storeLFSObject(fs, dot billy.Filesystem, name string) ([]byte, error) {
+	in, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	err = dot.MkdirAll(path.Join("lfs", "tmp"), 0o755)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := dot.TempFile(path.Join("lfs", "tmp"), "object")
+	if err != nil {
+		return nil, err
+	}
+	defer dot.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), in)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	oid := hex.EncodeToString(h.Sum(nil))
+	dir := path.Join("lfs", "objects", oid[:2], oid[2:4])
+	err = dot.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	err = dot.Rename(tmp.Name(), path.Join(dir, oid))
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", lfsPointerVersion, oid, size)), nil
+}
+
+// configureLFS does what git lfs install --local does: it sets up the
+// filter and adds the pre-push hook that uploads LFS objects, unless a
+// pre-push hook is already there.
+func configureLFS(repo *git.Repository) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repository config: %v", err)
+	}
+	filter := cfg.Raw.Section("filter").Subsection("lfs")
+	filter.SetOption("clean", "git-lfs clean -- %f")
+	filter.SetOption("smudge", "git-lfs smudge -- %f")
+	filter.SetOption("process", "git-lfs filter-process")
+	filter.SetOption("required", "true")
+	err = repo.Storer.SetConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to write repository config: %v", err)
+	}
+
+	dot := gitDir(repo)
+	hook := path.Join(hooksDirName, "pre-push")
+	if _, err := dot.Lstat(hook); err == nil {
+		return nil
+	}
+	err = dot.MkdirAll(hooksDirName, 0o755)
+	if err != nil {
+		return err
+	}
+	f, err := dot.OpenFile(hook, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(lfsPrePushHook)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,92 @@
+package greenleeks
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+const licenseFileName = "LICENSE"
+
+//go:embed licenses
+var licenseFS embed.FS
+
+// licenseAliases maps the deprecated SPDX identifiers WithLicense still
+// accepts to the ones that replaced them.
+var licenseAliases = map[string]string{
+	"GPL-3.0": "GPL-3.0-only",
+}
+
+// Licenses returns the SPDX identifiers accepted by WithLicense, leaving
+// out the deprecated ones in licenseAliases.
+func Licenses() []string {
+	entries, err := fs.ReadDir(licenseFS, "licenses")
+	if err != nil {
+		return nil
+	}
+
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.Name())
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// licenseContent renders the license text for id with holder and year
+// filled into its copyright line, where the license has one.
+func licenseContent(id, holder string, year int) ([]byte, error) {
+	text, err := licenseFS.ReadFile("licenses/" + id)
+	if err != nil {
+		return nil, fmt.Errorf("unknown license %q, want one of %s", id, strings.Join(Licenses(), ", "))
+	}
+
+	tmpl, err := template.New(id).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Year   int
+		Holder string
+	}{year, holder})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (i *Initializer) licenseFile(fs billy.Filesystem, pending []scaffoldFile, author AuthorInfo, date time.Time) (*scaffoldFile, error) {
+	exists, err := hasTopLevelFile(fs, pending, "LICENSE", "LICENCE", "COPYING")
+	if err != nil {
+		return nil, err
+	}
+
+	id := i.license
+	if canonical, ok := licenseAliases[id]; ok {
+		i.logger.Warn("deprecated SPDX identifier, using its replacement", "license", id, "replacement", canonical)
+		id = canonical
+	}
+
+	content, err := licenseContent(id, author.Name, date.Year())
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		i.logger.Info("directory already has a license, not adding one", "license", id)
+		return nil, nil
+	}
+
+	return &scaffoldFile{path: licenseFileName, content: content}, nil
+}
@@ -0,0 +1,91 @@
+package greenleeks
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// errLocked is what tryLock returns when another process holds the lock.
+var errLocked = errors.New("locked")
+
+// lockDir takes an advisory lock on dir for the length of a run, so that
+// two runs do not race on creating its repository. The lock file lives in
+// the per-user lock directory, keyed by the absolute path of dir, to stay
+// out of what is committed; it is left there afterwards.
+func lockDir(dir string) (func(), error) {
+	path, err := lockPath("greenleeks", dir)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := openLockFile(path, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tryLock(f)
+	if errors.Is(err, errLocked) {
+		f.Close()
+		return nil, fmt.Errorf("%w in %s", ErrInProgress, dir)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+	}
+
+	return func() {
+		_ = unlock(f)
+		f.Close()
+	}, nil
+}
+
+// lockPath returns the lock file in the per-user lock directory for dir,
+// named after prefix and the absolute path of dir.
+func lockPath(prefix, dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+
+	locks, err := lockDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(locks, fmt.Sprintf("%s-%x.lock", prefix, sum[:8])), nil
+}
+
+// lockDirectory returns the directory the lock files are kept in, creating
+// it readable by the current user only: greenleeks under $XDG_RUNTIME_DIR
+// when that is set and under the user cache directory otherwise. A shared
+// directory such as /tmp would let another user hold a lock, or plant a
+// symlink where a lock file is about to be written.
+func lockDirectory() (string, error) {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		var err error
+		base, err = os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find a directory for lock files: %w", err)
+		}
+	}
+
+	dir := filepath.Join(base, "greenleeks")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// openLockFile opens the lock file at path with flag, creating it for the
+// current user only. A symlink at path is refused rather than followed.
+func openLockFile(path string, flag int) (*os.File, error) {
+	return os.OpenFile(path, flag|os.O_CREATE|oNoFollow, 0o600)
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package greenleeks
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// oNoFollow makes opening a lock file fail on a symlink.
+const oNoFollow = syscall.O_NOFOLLOW
+
+func tryLock(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errLocked
+	}
+	return err
+}
+
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// stopProcess asks p to stop the way Ctrl-C would.
+func stopProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
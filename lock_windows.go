@@ -0,0 +1,33 @@
+//go:build windows
+
+package greenleeks
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// oNoFollow is 0: Windows has no O_NOFOLLOW, and its lock directory is
+// under the user profile.
+const oNoFollow = 0
+
+func tryLock(f *os.File) error {
+	var ol windows.Overlapped
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLocked
+	}
+	return err
+}
+
+func unlock(f *os.File) error {
+	var ol windows.Overlapped
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &ol)
+}
+
+// stopProcess ends p; Windows has no signal to ask it to.
+func stopProcess(p *os.Process) error {
+	return p.Kill()
+}
@@ -1,26 +1,56 @@
 package greenleeks
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 
 	"github.com/taylormonacelli/littlecow"
 )
 
-func getLogger(logLevel slog.Level, logFormat string) (*slog.Logger, error) {
+func getLogger(logLevel slog.Level, logFormat string, out io.Writer) (*slog.Logger, error) {
 	opts := littlecow.NewHandlerOptions(logLevel, littlecow.RemoveTimestampAndTruncateSource)
 
 	var handler slog.Handler
-	handler = slog.NewTextHandler(os.Stderr, opts)
+	handler = slog.NewTextHandler(out, opts)
 	if logFormat == "json" {
-		handler = slog.NewJSONHandler(os.Stderr, opts)
+		handler = slog.NewJSONHandler(out, opts)
 	}
 
 	return slog.New(handler), nil
 }
 
+// logOutput is where logs go: syslog, --log-file, or stderr, colored when
+// colorEnabled allows.
+func logOutput() (io.Writer, error) {
+	switch {
+	case opts.LogFormat == "syslog":
+		if opts.LogFile != "" {
+			return nil, errors.New("--log-file cannot be combined with --log-format syslog")
+		}
+		return openSyslog()
+	case opts.LogFile != "":
+		if opts.LogSize <= 0 {
+			return nil, fmt.Errorf("--log-max-size must be positive, got %d", opts.LogSize)
+		}
+		return openRotatingFile(opts.LogFile, opts.LogSize<<20)
+	case colorEnabled(os.Stderr):
+		return levelColorWriter{w: stderrBar}, nil
+	default:
+		return stderrBar, nil
+	}
+}
+
 func setupLogger() error {
-	logger, err := getLogger(opts.logLevel, opts.LogFormat)
+	out, err := logOutput()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	logger, err := getLogger(opts.logLevel, opts.LogFormat, out)
 	if err != nil {
 		slog.Error("getLogger", "error", err)
 		return err
@@ -29,8 +59,21 @@ func setupLogger() error {
 	return nil
 }
 
+// defaultLogFormat picks json when stdout goes to a pipe or file, for
+// scripts, and text on a terminal.
+func defaultLogFormat() string {
+	if isTerminal(os.Stdout) {
+		return "text"
+	}
+	return "json"
+}
+
 func setLogLevel() error {
 	switch {
+	case opts.Quiet && len(opts.Verbose) > 0:
+		return errors.New("--quiet and --verbose cannot be combined")
+	case opts.Quiet:
+		opts.logLevel = slog.LevelError
 	case len(opts.Verbose) >= 2:
 		opts.logLevel = slog.LevelDebug
 	case len(opts.Verbose) == 1:
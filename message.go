@@ -0,0 +1,263 @@
+package greenleeks
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/go-git/go-git/v5"
+	mymazda "github.com/taylormonacelli/forestfish/mymazda"
+)
+
+const (
+	signedOffByTrailer = "Signed-off-by"
+
+	// DefaultConventionalType is the Conventional Commits type WithConventional
+	// falls back to.
+	DefaultConventionalType = "chore"
+	conventionalSubject     = "initial commit"
+)
+
+// conventionalHeader matches a subject that already has a Conventional
+// Commits type, such as "feat(api)!: ".
+var conventionalHeader = regexp.MustCompile(`^[a-z]+(\([^()]+\))?!?: `)
+
+var hyphenRuns = regexp.MustCompile(`-+`)
+
+// MessageData holds the variables the commit message may use, e.g.
+// -m "Import {{.ProjectName}} ({{.FileCount}} files)".
+type MessageData struct {
+	TemplateData
+	// Dir is the absolute path of the directory.
+	Dir string
+	// FileCount is the number of files in the commit.
+	FileCount int
+}
+
+type trailer struct {
+	key   string
+	value string
+}
+
+// commitMessage returns the message resolved for this run, rendered with
+// MessageData and formatted by WithConventional, with the WithTrailer
+// trailers, then the WithSignoff one, appended as a final paragraph the
+// way git interpret-trailers lays them out. It is called once everything
+// is staged so that FileCount is known.
+func (i *Initializer) commitMessage(repo *git.Repository, rs *runState) (string, error) {
+	message, err := renderMessage(repo, rs)
+	if err != nil {
+		return "", err
+	}
+	if i.conventionalType != "" {
+		message = i.conventionalMessage(message, rs.dir)
+	}
+
+	return i.appendTrailers(message, rs), nil
+}
+
+// groupMessage is the message for a follow-up commit made by WithSplitBy,
+// adding the files described by label.
+func (i *Initializer) groupMessage(label string, rs *runState) string {
+	message := "Add " + label
+	if i.conventionalType != "" {
+		message = i.conventionalMessage("add "+label, rs.dir)
+	}
+	return i.appendTrailers(message, rs)
+}
+
+func (i *Initializer) appendTrailers(message string, rs *runState) string {
+	trailers := i.trailers
+	if i.signoff {
+		trailers = append(trailers[:len(trailers):len(trailers)], trailer{
+			key:   signedOffByTrailer,
+			value: fmt.Sprintf("%s <%s>", rs.committer.Name, rs.committer.Email),
+		})
+	}
+
+	if len(trailers) == 0 {
+		return message
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(message, "\n"))
+	b.WriteString("\n\n")
+	for _, t := range trailers {
+		fmt.Fprintf(&b, "%s: %s\n", t.key, t.value)
+	}
+	return b.String()
+}
+
+// baseMessage returns the message to start from: the WithMessage one,
+// unless it was left at DefaultCommitMessage and commit.template names a
+// file, whose contents are used instead, as git commit does. literal is
+// set for the latter, which is used as it is: it was written for git, not
+// as a MessageData template.
+func (i *Initializer) baseMessage(config *gitConfig) (message string, literal bool, err error) {
+	if i.message != DefaultCommitMessage || i.ignoreCommitTemplate {
+		return i.message, false, nil
+	}
+
+	path := config.get("commit", "", "template")
+	if path == "" {
+		return i.message, false, nil
+	}
+
+	path, err = mymazda.ExpandTilde(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read commit.template: %v", err)
+	}
+
+	message = stripComments(string(data))
+	if message == "" {
+		i.logger.Debug("commit.template is empty, using the default message", "path", path)
+		return i.message, false, nil
+	}
+
+	i.logger.Debug("using commit.template", "path", path)
+	return message, true, nil
+}
+
+// stripComments drops # comment lines and surrounding blank lines, as git
+// does with the default cleanup mode.
+func stripComments(s string) string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// messageTemplate parses the commit message as a text/template.
+func messageTemplate(message string) (*template.Template, error) {
+	tmpl, err := template.New("message").Parse(message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit message template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// checkMessage renders message with empty data, so that an unknown
+// variable fails Run before anything is written. A message that does not
+// parse as a template at all is taken to be plain text with braces in it,
+// which it reports as literal.
+func (i *Initializer) checkMessage(message string) (literal bool, err error) {
+	if !strings.Contains(message, "{{") {
+		return true, nil
+	}
+
+	tmpl, err := messageTemplate(message)
+	if err != nil {
+		i.logger.Debug("using the commit message as it is", "reason", err)
+		return true, nil
+	}
+	if err := tmpl.Execute(io.Discard, MessageData{}); err != nil {
+		return false, fmt.Errorf("invalid commit message template: %v", err)
+	}
+	return false, nil
+}
+
+func renderMessage(repo *git.Repository, rs *runState) (string, error) {
+	if rs.literalMessage {
+		return rs.message, nil
+	}
+
+	tmpl, err := messageTemplate(rs.message)
+	if err != nil {
+		return "", err
+	}
+
+	index, err := repo.Storer.Index()
+	if err != nil {
+		return "", err
+	}
+
+	abs, err := filepath.Abs(rs.dir)
+	if err != nil {
+		return "", err
+	}
+
+	data := MessageData{
+		TemplateData: newTemplateData(rs.dir, rs.author, rs.committerDate),
+		Dir:          abs,
+		FileCount:    len(index.Entries),
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render commit message: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// conventionalMessage prefixes message with the Conventional Commits type,
+// and the directory name as scope if asked for. The default message
+// becomes "initial commit"; one that already has a type is left alone.
+func (i *Initializer) conventionalMessage(message, dir string) string {
+	if message == DefaultCommitMessage {
+		message = conventionalSubject
+	}
+	if conventionalHeader.MatchString(message) {
+		return message
+	}
+
+	header := i.conventionalType
+	if i.conventionalScope {
+		header += "(" + conventionalScope(projectName(dir)) + ")"
+	}
+	return header + ": " + message
+}
+
+// conventionalScope turns a directory name into a commitlint friendly
+// scope: lower case, with runs of anything but letters, digits, dots and
+// underscores replaced by a hyphen.
+func conventionalScope(name string) string {
+	scope := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, name)
+	scope = hyphenRuns.ReplaceAllString(scope, "-")
+	return strings.Trim(scope, "-")
+}
+
+// parseTrailer splits a --trailer argument, given as key=value or
+// key: value.
+func parseTrailer(s string) (string, string, error) {
+	sep := strings.IndexAny(s, "=:")
+	if sep < 0 {
+		return "", "", fmt.Errorf("trailer %q is not key=value", s)
+	}
+
+	key := strings.TrimSpace(s[:sep])
+	value := strings.TrimSpace(s[sep+1:])
+	if key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", fmt.Errorf("trailer %q has an invalid key", s)
+	}
+	if value == "" {
+		return "", "", fmt.Errorf("trailer %q has no value", s)
+	}
+
+	return key, value, nil
+}
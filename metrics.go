@@ -0,0 +1,75 @@
+package greenleeks
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics served on --metrics-addr, counted from the results of init.
+var (
+	reposInitialized = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "greenleeks_repositories_initialized_total",
+		Help: "Repositories initialized and committed.",
+	})
+	runFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "greenleeks_failures_total",
+		Help: "Runs that failed.",
+	})
+	filesCommitted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "greenleeks_files_committed_total",
+		Help: "Files in the commits made.",
+	})
+	scanDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "greenleeks_scan_duration_seconds",
+		Help:    "Time spent walking a directory for the files to commit.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	})
+)
+
+// serveMetrics serves the metrics on addr in the background. Binding addr
+// happens here, so that a bad or busy address fails the run right away.
+func serveMetrics(addr string) error {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(reposInitialized, runFailures, filesCommitted, scanDuration)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	go func() {
+		err := http.Serve(ln, mux)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", "error", err)
+		}
+	}()
+
+	slog.Info("Serving metrics.", "url", "http://"+ln.Addr().String()+"/metrics")
+	return nil
+}
+
+// recordRun counts the outcome of one run of init. A directory already
+// under git control counts neither way.
+func recordRun(result *Result, err error) {
+	switch {
+	case errors.Is(err, ErrAlreadyUnderGit):
+		return
+	case err != nil:
+		runFailures.Inc()
+	}
+
+	if result == nil || result.CommitHash == "" {
+		return
+	}
+	reposInitialized.Inc()
+	filesCommitted.Add(float64(result.FilesAdded))
+	scanDuration.Observe(result.Phases.Scan.Seconds())
+}
@@ -0,0 +1,220 @@
+package greenleeks
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// NestedRepoPolicy selects what WithNestedRepos does with subdirectories
+// that hold a repository of their own.
+type NestedRepoPolicy string
+
+const (
+	// NestedReposEmbed commits a nested repository as a gitlink to the
+	// commit it has checked out, as git add does. Its files are not
+	// committed.
+	NestedReposEmbed NestedRepoPolicy = "embed"
+	// NestedReposSkip leaves nested repositories out of the commit.
+	NestedReposSkip NestedRepoPolicy = "skip"
+	// NestedReposAbort fails Run with ErrNestedRepository.
+	NestedReposAbort NestedRepoPolicy = "abort"
+	// NestedReposSubmodule commits nested repositories as gitlinks, as
+	// NestedReposEmbed does, and registers them as submodules in
+	// .gitmodules, with the URL of their origin remote.
+	NestedReposSubmodule NestedRepoPolicy = "submodule"
+)
+
+const gitmodulesFile = ".gitmodules"
+
+// nestedRepo is a nested repository to be committed as a gitlink.
+type nestedRepo struct {
+	path string
+	head plumbing.Hash
+	// url is where its origin remote points, if it has one.
+	url string
+}
+
+// nestedRepos applies WithNestedRepos to the nested repositories a scan
+// found and returns those to stage as gitlinks, if any.
+func (i *Initializer) nestedRepos(fs billy.Filesystem, nested []string) ([]nestedRepo, error) {
+	if len(nested) == 0 {
+		return nil, nil
+	}
+
+	switch i.nestedRepoPolicy {
+	case NestedReposAbort:
+		return nil, fmt.Errorf("%w: %s", ErrNestedRepository, strings.Join(nested, ", "))
+	case NestedReposSkip:
+		i.logger.Warn("leaving out nested repositories", "repositories", nested)
+		return nil, nil
+	}
+
+	if i.nestedRepoPolicy == NestedReposSubmodule {
+		i.logger.Info("Registering nested repositories as submodules.", "repositories", nested)
+	} else {
+		i.logger.Warn("committing nested repositories as gitlinks, their files are not committed", "repositories", nested)
+	}
+
+	var repos []nestedRepo
+	for _, path := range nested {
+		path = filepath.FromSlash(path)
+		repo, err := openNested(fs, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open nested repository %s: %v", path, err)
+		}
+
+		head, err := repo.Head()
+		if err != nil {
+			// git add refuses these as well.
+			i.logger.Warn("leaving out nested repository without a commit checked out", "path", filepath.ToSlash(path))
+			continue
+		}
+
+		n := nestedRepo{path: path, head: head.Hash()}
+		if remote, err := repo.Remote(defaultRemoteName); err == nil && len(remote.Config().URLs) > 0 {
+			n.url = remote.Config().URLs[0]
+		}
+		repos = append(repos, n)
+	}
+	return repos, nil
+}
+
+// gitlinks returns the scanned files that stage repos as gitlinks.
+func gitlinks(repos []nestedRepo) []scannedFile {
+	links := make([]scannedFile, 0, len(repos))
+	for _, n := range repos {
+		links = append(links, scannedFile{path: n.path, commit: n.head})
+	}
+	return links
+}
+
+// gitmodules returns .gitmodules with an entry added for each of repos it
+// does not have yet, or nil if it needs no change. A repository without an
+// origin remote gets its path as URL, relative to wherever the
+// superproject is cloned from, and a warning.
+func (i *Initializer) gitmodules(fs billy.Filesystem, repos []nestedRepo) ([]byte, error) {
+	existing, err := readFile(fs, gitmodulesFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	modules := config.NewModules()
+	if err := modules.Unmarshal(existing); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", gitmodulesFile, err)
+	}
+	registered := make(map[string]bool)
+	for _, m := range modules.Submodules {
+		registered[m.Path] = true
+	}
+
+	var b bytes.Buffer
+	b.Write(existing)
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	added := 0
+	for _, n := range repos {
+		path := filepath.ToSlash(n.path)
+		if registered[path] {
+			continue
+		}
+
+		url := n.url
+		if url == "" {
+			url = "./" + path
+			i.logger.Warn("nested repository has no origin remote, using its path as submodule URL", "path", path)
+		}
+		fmt.Fprintf(&b, "[submodule %q]\n\tpath = %s\n\turl = %s\n", path, path, url)
+		added++
+	}
+
+	if added == 0 {
+		return nil, nil
+	}
+	return b.Bytes(), nil
+}
+
+// registerSubmodules writes .gitmodules for repos and records their URLs
+// in the repository config, as git submodule add does. It returns the
+// .gitmodules file to stage, or nil if it was not changed.
+func (i *Initializer) registerSubmodules(fs billy.Filesystem, repo *git.Repository, repos []nestedRepo) (*scannedFile, error) {
+	content, err := i.gitmodules(fs, repos)
+	if err != nil || content == nil {
+		return nil, err
+	}
+
+	err = util.WriteFile(fs, gitmodulesFile, content, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Lstat(gitmodulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	modules := config.NewModules()
+	if err := modules.Unmarshal(content); err != nil {
+		return nil, err
+	}
+	for name, m := range modules.Submodules {
+		cfg.Submodules[name] = &config.Submodule{Name: name, URL: m.URL}
+	}
+	if err := repo.Storer.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	return &scannedFile{path: gitmodulesFile, info: info}, nil
+}
+
+// openNested opens the repository in the directory path of fs. On disk a
+// .git file pointing elsewhere, as a submodule or linked worktree has, is
+// followed.
+func openNested(fs billy.Filesystem, path string) (*git.Repository, error) {
+	if root, ok := diskRoot(fs); ok {
+		return git.PlainOpenWithOptions(filepath.Join(root, path), &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+	}
+
+	chroot, err := fs.Chroot(path)
+	if err != nil {
+		return nil, err
+	}
+	return openRepository(chroot)
+}
+
+// mergeFiles adds more to files, keeping them sorted by path. A file in
+// both is listed once.
+func mergeFiles(files, more []scannedFile) []scannedFile {
+	if len(more) == 0 {
+		return files
+	}
+
+	seen := make(map[string]bool, len(more))
+	for _, f := range more {
+		seen[f.path] = true
+	}
+	merged := make([]scannedFile, 0, len(files)+len(more))
+	for _, f := range files {
+		if !seen[f.path] {
+			merged = append(merged, f)
+		}
+	}
+	merged = append(merged, more...)
+	sort.Slice(merged, func(a, b int) bool {
+		return filepath.ToSlash(merged[a].path) < filepath.ToSlash(merged[b].path)
+	})
+	return merged
+}
@@ -0,0 +1,168 @@
+package greenleeks
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitRepo initializes a repository in dir with one commit and returns
+// the commit.
+func commitRepo(t *testing.T, dir string) plumbing.Hash {
+	t.Helper()
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("content\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("file"); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(0, 0)}
+	hash, err := worktree.Commit("nested", &git.CommitOptions{Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// addLinkedWorktree lays out dir as a linked worktree of the repository in
+// main, on a new branch at commit, the way git worktree add does. The
+// branch lives in main, so HEAD only resolves through commondir.
+func addLinkedWorktree(t *testing.T, main, dir string, commit plumbing.Hash) {
+	t.Helper()
+
+	name := filepath.Base(dir)
+	admin := filepath.Join(main, ".git", "worktrees", name)
+	files := map[string]string{
+		filepath.Join(main, ".git", "refs", "heads", name): commit.String() + "\n",
+		filepath.Join(admin, "HEAD"):                       "ref: refs/heads/" + name + "\n",
+		filepath.Join(admin, "commondir"):                  "../..\n",
+		filepath.Join(admin, "gitdir"):                     filepath.Join(dir, ".git") + "\n",
+		filepath.Join(dir, ".git"):                         "gitdir: " + admin + "\n",
+		filepath.Join(dir, "file"):                         "content\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNestedRepos(t *testing.T) {
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("HOME", t.TempDir())
+
+	tests := []struct {
+		name string
+		// setup creates the nested repository in dir and returns the
+		// commit it has checked out.
+		setup func(t *testing.T, dir string) plumbing.Hash
+	}{
+		{
+			name:  "repository",
+			setup: commitRepo,
+		},
+		{
+			name: "linked worktree",
+			setup: func(t *testing.T, dir string) plumbing.Hash {
+				main := filepath.Join(t.TempDir(), "main")
+				commit := commitRepo(t, main)
+				addLinkedWorktree(t, main, dir, commit)
+				return commit
+			},
+		},
+		{
+			name: "linked worktree with a relative gitdir",
+			setup: func(t *testing.T, dir string) plumbing.Hash {
+				main := filepath.Join(filepath.Dir(dir), "..", "main")
+				commit := commitRepo(t, main)
+				addLinkedWorktree(t, main, dir, commit)
+				gitdir := filepath.Join("..", "..", "main", ".git", "worktrees", filepath.Base(dir))
+				if err := os.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: "+gitdir+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return commit
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := filepath.Join(t.TempDir(), "project")
+			if err := os.MkdirAll(project, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(project, "README.md"), []byte("hello\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			want := tt.setup(t, filepath.Join(project, "vendor"))
+
+			repo, err := openNested(osfs.New(project), "vendor")
+			if err != nil {
+				t.Fatalf("openNested: %v", err)
+			}
+			head, err := repo.Head()
+			if err != nil {
+				t.Fatalf("Head: %v", err)
+			}
+			if head.Hash() != want {
+				t.Errorf("HEAD = %s, want %s", head.Hash(), want)
+			}
+
+			i := New(
+				WithAuthor("Test", "test@example.com"),
+				WithNestedRepos(NestedReposEmbed),
+				WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			)
+			result, err := i.Run(context.Background(), project)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if !slices.Equal(result.NestedRepos, []string{"vendor"}) {
+				t.Errorf("NestedRepos = %v, want [vendor]", result.NestedRepos)
+			}
+
+			committed, err := git.PlainOpen(project)
+			if err != nil {
+				t.Fatal(err)
+			}
+			commit, err := committed.CommitObject(plumbing.NewHash(result.CommitHash))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree, err := commit.Tree()
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry, err := tree.FindEntry("vendor")
+			if err != nil {
+				t.Fatalf("vendor not committed: %v", err)
+			}
+			if entry.Mode != filemode.Submodule || entry.Hash != want {
+				t.Errorf("vendor committed as %s %s, want a gitlink to %s", entry.Mode, entry.Hash, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package greenleeks
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// Option configures an Initializer.
+type Option func(*Initializer)
+
+// SignMode controls whether the initial commit is signed.
+type SignMode int
+
+const (
+	// SignAuto signs when commit.gpgsign is set in the git config.
+	SignAuto SignMode = iota
+	// SignAlways signs regardless of the git config.
+	SignAlways
+	// SignNever never signs, even if commit.gpgsign is set.
+	SignNever
+)
+
+// WithMaxFiles refuses to commit directories holding more than n files to
+// commit: what .gitignore, WithExcludes, WithMaxDepth and a SymlinksSkip
+// policy leave out does not count.
+func WithMaxFiles(n int) Option {
+	return func(i *Initializer) {
+		i.maxFiles = n
+	}
+}
+
+// WithUnlimitedFiles lifts the WithMaxFiles limit, for an import that is
+// known to be large.
+func WithUnlimitedFiles(unlimited bool) Option {
+	return func(i *Initializer) {
+		i.unlimitedFiles = unlimited
+	}
+}
+
+// WithMessage sets the message of the initial commit.
+func WithMessage(message string) Option {
+	return func(i *Initializer) {
+		i.message = message
+	}
+}
+
+// WithGitConfig reads identity and signing settings from path instead of
+// git's global config lookup.
+func WithGitConfig(path string) Option {
+	return func(i *Initializer) {
+		i.gitConfig = path
+	}
+}
+
+// WithExcludes leaves files matching any of the gitignore patterns out of
+// both the file count and the commit, on top of the directory's own
+// .gitignore files.
+func WithExcludes(patterns ...string) Option {
+	return func(i *Initializer) {
+		for _, p := range patterns {
+			i.excludes = append(i.excludes, gitignore.ParsePattern(p, nil))
+		}
+	}
+}
+
+// WithMaxDepth leaves files deeper than depth out of both the file count
+// and the commit, counting top-level files as depth 1, as find -maxdepth
+// does. Result and Plan list what was cut off. Zero means no limit.
+func WithMaxDepth(depth int) Option {
+	return func(i *Initializer) {
+		i.maxDepth = depth
+	}
+}
+
+// WithScanTimeout gives up on walking the directory after d, which guards
+// against network filesystems that stop answering. Zero means no limit.
+func WithScanTimeout(d time.Duration) Option {
+	return func(i *Initializer) {
+		i.scanTimeout = d
+	}
+}
+
+// WithExcludeHidden leaves hidden files and directories, like .idea and
+// .vscode, out of both the file count and the commit. The files git and
+// the forges read, such as .gitignore and .github, are kept.
+func WithExcludeHidden(exclude bool) Option {
+	return func(i *Initializer) {
+		i.excludeHidden = exclude
+	}
+}
+
+// WithScaffoldReadme writes a README.md titled after the directory before
+// the initial commit, unless the directory already has a README.
+func WithScaffoldReadme(scaffold bool) Option {
+	return func(i *Initializer) {
+		i.scaffoldReadme = scaffold
+	}
+}
+
+// WithGitattributes writes a .gitattributes with "* text=auto" and eol
+// and binary rules for common extensions before the initial commit,
+// unless the directory already has one, and stages text files with LF
+// line endings as git would under it.
+func WithGitattributes(write bool) Option {
+	return func(i *Initializer) {
+		i.gitattributes = write
+	}
+}
+
+// WithKeepEmptyDirs writes an empty .gitkeep into every empty directory
+// before the initial commit, so that the directory structure survives it.
+func WithKeepEmptyDirs(keep bool) Option {
+	return func(i *Initializer) {
+		i.keepEmptyDirs = keep
+	}
+}
+
+// WithLicense adds a LICENSE file for the SPDX identifier id, one of
+// Licenses(), with the author's name and the current year in the copyright
+// line. An existing LICENSE or COPYING file is left alone.
+func WithLicense(id string) Option {
+	return func(i *Initializer) {
+		i.license = id
+	}
+}
+
+// WithTemplateDir copies dir into the new .git directory, as git init
+// --template does, overriding GIT_TEMPLATE_DIR and init.templateDir.
+func WithTemplateDir(dir string) Option {
+	return func(i *Initializer) {
+		i.template = dir
+	}
+}
+
+// WithHooksDir copies the hook scripts in dir into the new repository's
+// hooks directory as executables, after any template directory, so that
+// every repository starts with the same pre-commit and commit-msg hooks.
+func WithHooksDir(dir string) Option {
+	return func(i *Initializer) {
+		i.hooks = dir
+	}
+}
+
+// WithHooksPath sets core.hooksPath in the new repository's config, such
+// as ".githooks" for hooks that are committed with the project. It takes
+// the place of a globally configured core.hooksPath.
+func WithHooksPath(path string) Option {
+	return func(i *Initializer) {
+		i.hooksPath = path
+	}
+}
+
+// WithLFS stores archives, media and other binaries, and any file of
+// WithLFSThreshold bytes or more, in Git LFS: .gitattributes gets the
+// rules git lfs track would write and pointers are committed in place of
+// the contents. Without it such files are only warned about.
+func WithLFS(enable bool) Option {
+	return func(i *Initializer) {
+		i.lfs = enable
+	}
+}
+
+// WithLFSThreshold sets the size from which any file is considered for
+// Git LFS. It defaults to DefaultLFSThreshold.
+func WithLFSThreshold(size int64) Option {
+	return func(i *Initializer) {
+		i.lfsThreshold = size
+	}
+}
+
+// WithNoBinaries leaves files that git would treat as binary, those with
+// a NUL byte near the start, out of the initial commit.
+func WithNoBinaries(exclude bool) Option {
+	return func(i *Initializer) {
+		i.noBinaries = exclude
+	}
+}
+
+// WithSymlinks sets what happens to symbolic links: SymlinksKeep, the
+// default, commits them as links, SymlinksFollow commits what they point
+// at and SymlinksSkip leaves them out.
+func WithSymlinks(policy SymlinkPolicy) Option {
+	return func(i *Initializer) {
+		i.symlinks = policy
+	}
+}
+
+// WithNestedRepos selects what happens to subdirectories that hold a
+// repository of their own; the default is NestedReposEmbed.
+func WithNestedRepos(policy NestedRepoPolicy) Option {
+	return func(i *Initializer) {
+		i.nestedRepoPolicy = policy
+	}
+}
+
+// WithNoVerify skips the pre-commit hook, like git commit --no-verify.
+func WithNoVerify(skip bool) Option {
+	return func(i *Initializer) {
+		i.noVerify = skip
+	}
+}
+
+// WithFromTemplate copies the files of the repository at url, without its
+// history, into the directory before the initial commit. Append "#branch"
+// to url to pick a branch other than the default.
+func WithFromTemplate(url string) Option {
+	return func(i *Initializer) {
+		i.fromTemplate = url
+	}
+}
+
+// WithBare creates a bare repository in the directory, as git init --bare
+// does. Scaffolded files are committed without being written to disk; with
+// nothing to scaffold the repository is left empty.
+func WithBare(bare bool) Option {
+	return func(i *Initializer) {
+		i.bare = bare
+	}
+}
+
+// WithSeparateGitDir stores the repository in dir instead of .git, as git
+// init --separate-git-dir does, and leaves a .git file pointing at it. A
+// relative dir is resolved against the working directory, or against the
+// root of the filesystem given to WithFilesystem.
+func WithSeparateGitDir(dir string) Option {
+	return func(i *Initializer) {
+		i.separateGitDir = dir
+	}
+}
+
+// WithDotfiles sets up the directory, normally the home directory, for the
+// bare dotfiles workflow: the repository goes to .dotfiles.git, or the
+// directory given to WithSeparateGitDir, with the directory as its work
+// tree and no .git left behind. Only paths, or DefaultDotfiles if none are
+// given, are committed, and those that do not exist are skipped.
+func WithDotfiles(paths ...string) Option {
+	return func(i *Initializer) {
+		if len(paths) == 0 {
+			paths = DefaultDotfiles
+		}
+		i.dotfiles = paths
+	}
+}
+
+// WithTag tags the initial commit as name. A non-empty message makes it an
+// annotated tag, with the committer as tagger; otherwise it is lightweight.
+func WithTag(name, message string) Option {
+	return func(i *Initializer) {
+		i.tag = name
+		i.tagMessage = message
+	}
+}
+
+// WithIgnoreCommitTemplate keeps the default message even when the git
+// config sets commit.template.
+func WithIgnoreCommitTemplate(ignore bool) Option {
+	return func(i *Initializer) {
+		i.ignoreCommitTemplate = ignore
+	}
+}
+
+// WithDate pins the author and committer dates of the initial commit,
+// overriding SOURCE_DATE_EPOCH, GIT_AUTHOR_DATE and GIT_COMMITTER_DATE.
+func WithDate(date time.Time) Option {
+	return func(i *Initializer) {
+		i.date = date
+	}
+}
+
+// WithReproducible makes the initial commit depend only on its inputs:
+// dates default to the Unix epoch instead of now and are recorded in UTC,
+// and commit.gpgsign is ignored since GPG signatures embed a timestamp.
+// Trees are always written in git's sorted order, so identical directories
+// then give identical commit hashes.
+func WithReproducible(reproducible bool) Option {
+	return func(i *Initializer) {
+		i.reproducible = reproducible
+	}
+}
+
+// WithAllowEmpty lets Run create an initial commit with no files when the
+// directory is empty or everything in it is ignored, instead of failing
+// with ErrNothingToCommit. A bare repository gets an empty commit too
+// rather than being left without one.
+func WithAllowEmpty(allow bool) Option {
+	return func(i *Initializer) {
+		i.allowEmpty = allow
+	}
+}
+
+// WithResume lets Run finish a repository that has no commits yet, as an
+// aborted run or a bare git init leaves behind, instead of returning
+// ErrAlreadyUnderGit. The template and hooks are not copied again.
+func WithResume(resume bool) Option {
+	return func(i *Initializer) {
+		i.resume = resume
+	}
+}
+
+// WithRerun lets Run commit again in a repository that holds nothing but
+// what an earlier Run committed and that has not been published, instead
+// of returning ErrAlreadyUnderGit, as mode says. If nothing changed, the
+// repository is left alone. Amending drops the tags of the replaced
+// commit; WithTag tags the new one.
+func WithRerun(mode RerunMode) Option {
+	return func(i *Initializer) {
+		i.rerun = mode
+	}
+}
+
+// WithSplitBy spreads the initial import over several commits, one per
+// group of files as mode defines, instead of a single one. The first
+// commit gets the configured message and the rest "Add <group>".
+func WithSplitBy(mode SplitMode) Option {
+	return func(i *Initializer) {
+		i.splitBy = mode
+	}
+}
+
+// WithFirstCommit commits the files matching any of the gitignore
+// patterns, such as README, LICENSE and go.mod, on their own as the root
+// commit, with the configured message. The remaining files follow in an
+// "Add remaining files" commit, or as WithSplitBy groups them.
+func WithFirstCommit(patterns ...string) Option {
+	return func(i *Initializer) {
+		for _, p := range patterns {
+			i.firstCommit = append(i.firstCommit, gitignore.ParsePattern(p, nil))
+		}
+	}
+}
+
+// WithConventional formats the commit message as a Conventional Commits
+// subject of commitType, DefaultConventionalType if empty, such as
+// "chore: initial commit". With scoped set the directory name becomes the
+// scope. A message that already starts with a type is kept as it is.
+func WithConventional(commitType string, scoped bool) Option {
+	return func(i *Initializer) {
+		if commitType == "" {
+			commitType = DefaultConventionalType
+		}
+		i.conventionalType = commitType
+		i.conventionalScope = scoped
+	}
+}
+
+// WithTrailer appends a "key: value" trailer to the commit message. It can
+// be given more than once.
+func WithTrailer(key, value string) Option {
+	return func(i *Initializer) {
+		i.trailers = append(i.trailers, trailer{key: key, value: value})
+	}
+}
+
+// WithSignoff adds a Signed-off-by trailer for the committer, as git
+// commit --signoff does, after any WithTrailer trailers.
+func WithSignoff(signoff bool) Option {
+	return func(i *Initializer) {
+		i.signoff = signoff
+	}
+}
+
+// WithAuthor overrides the author resolved from the git config and
+// environment. Empty fields are left to resolution.
+func WithAuthor(name, email string) Option {
+	return func(i *Initializer) {
+		i.author = AuthorInfo{Name: name, Email: email}
+	}
+}
+
+// WithAllowPlaceholderIdentity permits committing as the placeholder
+// identity when none could be resolved.
+func WithAllowPlaceholderIdentity(allow bool) Option {
+	return func(i *Initializer) {
+		i.allowPlaceholder = allow
+	}
+}
+
+// WithIdentityFallback is called with the partially resolved identity when
+// no user.name or user.email could be found, giving the caller a chance to
+// supply one, for example by prompting.
+func WithIdentityFallback(fn func(AuthorInfo) (AuthorInfo, error)) Option {
+	return func(i *Initializer) {
+		i.identityFallback = fn
+	}
+}
+
+// WithSignMode controls commit signing.
+func WithSignMode(mode SignMode) Option {
+	return func(i *Initializer) {
+		i.signMode = mode
+	}
+}
+
+// WithSigningKeyring signs with a key from an OpenPGP keyring file rather
+// than through gpg-agent.
+func WithSigningKeyring(path string) Option {
+	return func(i *Initializer) {
+		i.signingKeyring = path
+	}
+}
+
+// WithSSHSigningKey signs with an SSH key. It implies SignAlways unless
+// signing was explicitly disabled.
+func WithSSHSigningKey(path string) Option {
+	return func(i *Initializer) {
+		i.sshSigningKey = path
+	}
+}
+
+// WithProvider creates a repository on the hosting provider after the
+// initial commit and pushes to it.
+func WithProvider(provider Provider) Option {
+	return func(i *Initializer) {
+		i.provider = provider
+	}
+}
+
+// WithRetries retries creating the remote repository and pushing to it up
+// to n times, backing off exponentially, when they fail with a network
+// error or a 5xx answer. Zero fails on the first error.
+func WithRetries(n int) Option {
+	return func(i *Initializer) {
+		i.retries = n
+	}
+}
+
+// WithPrivateRemote makes the repository created by WithProvider private.
+func WithPrivateRemote(private bool) Option {
+	return func(i *Initializer) {
+		i.private = private
+	}
+}
+
+// WithProgress calls fn as Run moves through scanning, staging and
+// committing. fn is called synchronously and should return quickly.
+func WithProgress(fn func(Event)) Option {
+	return func(i *Initializer) {
+		i.progress = fn
+	}
+}
+
+// WithLogger sends Run's log output to logger instead of slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(i *Initializer) {
+		i.logger = logger
+	}
+}
+
+// WithLogHandler is WithLogger for callers that only have a handler.
+func WithLogHandler(handler slog.Handler) Option {
+	return WithLogger(slog.New(handler))
+}
+
+// WithFilesystem runs against fs instead of the local disk. The directory
+// passed to Run is then a path inside fs, which makes memfs usable for
+// tests.
+func WithFilesystem(fs billy.Filesystem) Option {
+	return func(i *Initializer) {
+		i.fs = fs
+	}
+}
@@ -0,0 +1,317 @@
+package greenleeks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Plan describes what Run would commit, without touching the directory.
+type Plan struct {
+	Dir       string
+	Branch    string
+	Author    AuthorInfo
+	Committer AuthorInfo
+	// Files lists what would be staged, after .gitignore and WithExcludes,
+	// sorted by path, followed by any files scaffolding would add.
+	Files []PlannedFile
+	// CutOff lists what WithMaxDepth leaves out, as Result.CutOff does.
+	CutOff []string
+	// NestedRepos lists the subdirectories holding a repository of their
+	// own, as Result.NestedRepos does.
+	NestedRepos []string
+}
+
+// PlannedFile is a file that would be part of the initial commit.
+type PlannedFile struct {
+	// Path is relative to Plan.Dir and uses forward slashes.
+	Path string
+	Size int64
+	// Binary is set for files git would treat as binary.
+	Binary bool
+	// Gitlink is set for a nested repository committed as a gitlink.
+	Gitlink bool
+}
+
+// BinaryFiles returns how many of the planned files are binary.
+func (p *Plan) BinaryFiles() int {
+	n := 0
+	for _, f := range p.Files {
+		if f.Binary {
+			n++
+		}
+	}
+	return n
+}
+
+// TotalSize returns the combined size of the planned files.
+func (p *Plan) TotalSize() int64 {
+	var total int64
+	for _, f := range p.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// Plan resolves the identity and lists the files Run would commit for
+// dir. Unlike Run it never prompts, writes, or fails on a placeholder
+// identity; check Plan.Author.IsPlaceholder instead.
+func (i *Initializer) Plan(ctx context.Context, dir string) (*Plan, error) {
+	config, err := i.readGitConfig(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git config: %w", err)
+	}
+
+	author := i.resolveAuthor(config)
+
+	_, date, err := i.commitDates()
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := i.filesystem(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+
+	isUnderGit, err := isUnderGitControl(fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if directory is under git control: %w", err)
+	}
+
+	if isUnderGit {
+		return nil, ErrAlreadyUnderGit
+	}
+
+	// A bare repository commits only what scaffolding adds, built in a
+	// worktree that starts out empty.
+	var files []PlannedFile
+	worktree := fs
+	var scanned *scanResult
+	switch {
+	case i.bare:
+		worktree = memfs.New()
+	case i.dotfiles != nil:
+		files, err = i.plannedDotfiles(ctx, fs)
+	default:
+		files, scanned, err = i.plannedFiles(ctx, fs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	files, err = i.plannedSymlinks(ctx, fs, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply the symlink policy: %w", err)
+	}
+
+	files, err = i.plannedBinaries(fs, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for binary files: %w", err)
+	}
+
+	var cutOff, nested []string
+	if scanned != nil {
+		cutOff, nested = scanned.cutOff, scanned.nested
+		files, err = i.plannedGitlinks(fs, files, nested)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scaffold, err := i.scaffoldFiles(ctx, worktree, dir, author, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare scaffolding: %w", err)
+	}
+	files = append(files, plannedScaffold(scaffold)...)
+
+	return &Plan{
+		Dir:         dir,
+		Branch:      plumbing.Master.Short(),
+		Author:      author,
+		Committer:   resolveCommitter(config, author),
+		Files:       files,
+		CutOff:      cutOff,
+		NestedRepos: nested,
+	}, nil
+}
+
+// plannedFiles scans fs the way git add would, skipping .git and anything
+// matched by .gitignore files or the configured excludes, and returns the
+// files, sorted by path, along with the rest of what the scan found.
+func (i *Initializer) plannedFiles(ctx context.Context, fs billy.Filesystem) ([]PlannedFile, *scanResult, error) {
+	s := &scanner{
+		fs:         fs,
+		excludes:   i.excludes,
+		maxDepth:   i.maxDepth,
+		skipLinks:  i.symlinks == SymlinksSkip,
+		skipHidden: i.excludeHidden,
+	}
+	scanned, err := i.scan(ctx, s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := make([]PlannedFile, 0, len(scanned.files))
+	for _, f := range scanned.files {
+		files = append(files, PlannedFile{Path: filepath.ToSlash(f.path), Size: f.info.Size()})
+	}
+	return files, scanned, nil
+}
+
+// plannedGitlinks adds the nested repositories WithNestedRepos commits as
+// gitlinks to files, along with .gitmodules for NestedReposSubmodule.
+// Unlike Run it does not fail for NestedReposAbort.
+func (i *Initializer) plannedGitlinks(fs billy.Filesystem, files []PlannedFile, nested []string) ([]PlannedFile, error) {
+	if i.nestedRepoPolicy == NestedReposSkip || i.nestedRepoPolicy == NestedReposAbort || len(nested) == 0 {
+		return files, nil
+	}
+
+	repos, err := i.nestedRepos(fs, nested)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range repos {
+		files = append(files, PlannedFile{Path: filepath.ToSlash(n.path), Gitlink: true})
+	}
+
+	if i.nestedRepoPolicy == NestedReposSubmodule {
+		content, err := i.gitmodules(fs, repos)
+		if err != nil {
+			return nil, err
+		}
+		if content != nil {
+			kept := files[:0]
+			for _, f := range files {
+				if f.Path != gitmodulesFile {
+					kept = append(kept, f)
+				}
+			}
+			files = append(kept, PlannedFile{Path: gitmodulesFile, Size: int64(len(content))})
+		}
+	}
+	sort.Slice(files, func(a, b int) bool { return files[a].Path < files[b].Path })
+	return files, nil
+}
+
+// plannedDotfiles lists the files WithDotfiles would commit.
+func (i *Initializer) plannedDotfiles(ctx context.Context, fs billy.Filesystem) ([]PlannedFile, error) {
+	listed, _, err := i.dotfileList(ctx, fs)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]PlannedFile, 0, len(listed))
+	for _, f := range listed {
+		files = append(files, PlannedFile{Path: filepath.ToSlash(f.path), Size: f.info.Size()})
+	}
+
+	return files, nil
+}
+
+func runPlan() error {
+	options, err := cliOptions()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	i := New(options...)
+	plan, err := i.Plan(ctx, opts.RootDir)
+	if err != nil {
+		return err
+	}
+
+	printPlan(os.Stdout, plan, opts.Plan.Largest)
+
+	if err := i.checkFileLimit(len(plan.Files)); err != nil {
+		return err
+	}
+	if NestedRepoPolicy(opts.Nested) == NestedReposAbort && len(plan.NestedRepos) > 0 {
+		return fmt.Errorf("%w: %s", ErrNestedRepository, strings.Join(plan.NestedRepos, ", "))
+	}
+
+	return nil
+}
+
+// printPlan lists the planned files, and then the largest of them again,
+// so that a core dump or dataset about to be committed stands out.
+func printPlan(out io.Writer, plan *Plan, largest int) {
+	author := fmt.Sprintf("%s <%s>", plan.Author.Name, plan.Author.Email)
+	if plan.Author.IsPlaceholder() {
+		author += " (placeholder)"
+	}
+
+	dir := plan.Dir
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	fmt.Fprintf(out, "Directory: %s\n", dir)
+	fmt.Fprintf(out, "Branch:    %s\n", plan.Branch)
+	fmt.Fprintf(out, "Author:    %s\n", author)
+	if plan.Committer != plan.Author {
+		fmt.Fprintf(out, "Committer: %s <%s>\n", plan.Committer.Name, plan.Committer.Email)
+	}
+	fmt.Fprintln(out)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, f := range plan.Files {
+		note := ""
+		switch {
+		case f.Binary:
+			note = " (binary)"
+		case f.Gitlink:
+			note = " (gitlink)"
+		}
+		fmt.Fprintf(w, "%s\t  %s%s\n", formatSize(f.Size), f.Path, note)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\n%d files, %s", len(plan.Files), formatSize(plan.TotalSize()))
+	if n := plan.BinaryFiles(); n > 0 {
+		fmt.Fprintf(out, ", %d binary", n)
+	}
+	fmt.Fprintln(out)
+
+	printLargest(out, plan, largest)
+
+	if len(plan.CutOff) > 0 {
+		fmt.Fprintf(out, "\nLeft out below --max-depth:\n")
+		for _, path := range plan.CutOff {
+			fmt.Fprintf(out, "  %s\n", path)
+		}
+	}
+
+	if len(plan.NestedRepos) > 0 {
+		fmt.Fprintf(out, "\nNested repositories:\n")
+		for _, path := range plan.NestedRepos {
+			fmt.Fprintf(out, "  %s/\n", path)
+		}
+	}
+}
+
+// formatSize renders n bytes with a binary unit, as ls -h does.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,112 @@
+package greenleeks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	mymazda "github.com/taylormonacelli/forestfish/mymazda"
+)
+
+const (
+	preCommitHook       = "pre-commit"
+	preCommitConfigFile = ".pre-commit-config.yaml"
+)
+
+// runPreCommit runs the pre-commit hook against what is staged, as git
+// commit does and go-git does not, and fails if it exits non-zero. The
+// hook is looked up in core.hooksPath, else the hooks directory that a
+// template or WithHooksDir filled. Without one, a .pre-commit-config.yaml
+// is run with the pre-commit framework if that is installed.
+func (i *Initializer) runPreCommit(ctx context.Context, repo *git.Repository, rs *runState) error {
+	if i.noVerify {
+		return nil
+	}
+	if i.fs != nil {
+		i.logger.Debug("not running hooks on a custom filesystem")
+		return nil
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	worktreePath, err := filepath.Abs(worktree.Filesystem.Root())
+	if err != nil {
+		return err
+	}
+	gitDirPath, err := filepath.Abs(gitDir(repo).Root())
+	if err != nil {
+		return err
+	}
+
+	hooksPath := filepath.Join(gitDirPath, hooksDirName)
+	if rs.coreHooksPath != "" {
+		hooksPath, err = mymazda.ExpandTilde(rs.coreHooksPath)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(hooksPath) {
+			hooksPath = filepath.Join(worktreePath, hooksPath)
+		}
+	}
+
+	var cmd *exec.Cmd
+	hook := filepath.Join(hooksPath, preCommitHook)
+	if info, err := os.Stat(hook); err == nil && info.Mode().IsRegular() {
+		cmd = hookCommand(ctx, hook, info)
+		if cmd == nil {
+			i.logger.Warn("The pre-commit hook was ignored because it is not executable.", "hook", hook)
+			return nil
+		}
+	} else if _, err := os.Stat(filepath.Join(worktreePath, preCommitConfigFile)); err == nil {
+		program, err := exec.LookPath(preCommitHook)
+		if err != nil {
+			i.logger.Warn("pre-commit is not installed, not running "+preCommitConfigFile, "dir", rs.dir)
+			return nil
+		}
+		cmd = exec.CommandContext(ctx, program, "run")
+	} else {
+		return nil
+	}
+
+	i.logger.Info("Running pre-commit hook...", "command", strings.Join(cmd.Args, " "))
+
+	var output bytes.Buffer
+	cmd.Dir = worktreePath
+	cmd.Env = append(os.Environ(),
+		"GIT_DIR="+gitDirPath,
+		"GIT_WORK_TREE="+worktreePath,
+		"GIT_INDEX_FILE="+filepath.Join(gitDirPath, "index"),
+	)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pre-commit hook failed: %v: %s", err, strings.TrimSpace(output.String()))
+	}
+
+	if out := strings.TrimSpace(output.String()); out != "" {
+		i.logger.Debug("pre-commit hook output", "output", out)
+	}
+	return nil
+}
+
+// hookCommand returns the command that runs hook, or nil when git would
+// skip it for not being executable. Windows has no executable bit, so
+// there the hook is handed to sh, as Git for Windows does.
+func hookCommand(ctx context.Context, hook string, info os.FileInfo) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "sh", hook)
+	}
+	if info.Mode().Perm()&0o111 == 0 {
+		return nil
+	}
+	return exec.CommandContext(ctx, hook)
+}
@@ -0,0 +1,58 @@
+package greenleeks
+
+// EventType identifies a step of Initializer.Run reported to WithProgress.
+type EventType int
+
+const (
+	// ScanStarted is sent before the directory is walked.
+	ScanStarted EventType = iota
+	// FileCounted is sent for every file found by the scan.
+	FileCounted
+	// Staging is sent once, before the counted files are added to the index.
+	Staging
+	// FilesStaged is sent as the files are added to the index, in batches,
+	// with the number staged so far.
+	FilesStaged
+	// Committed is sent after the initial commit has been created.
+	Committed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case ScanStarted:
+		return "ScanStarted"
+	case FileCounted:
+		return "FileCounted"
+	case Staging:
+		return "Staging"
+	case FilesStaged:
+		return "FilesStaged"
+	case Committed:
+		return "Committed"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event describes progress of Initializer.Run. Only the fields relevant to
+// Type are set.
+type Event struct {
+	Type EventType
+	// Dir is the directory being initialized.
+	Dir string
+	// Path is the file that was just counted, relative to Dir.
+	Path string
+	// Files is the number of files counted so far, the total for Staging
+	// and the number staged so far for FilesStaged.
+	Files int
+	// Bytes is the size of the files Files counts.
+	Bytes int64
+	// Commit is the hash of the new commit.
+	Commit string
+}
+
+func (i *Initializer) emit(e Event) {
+	if i.progress != nil {
+		i.progress(e)
+	}
+}
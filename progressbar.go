@@ -0,0 +1,97 @@
+package greenleeks
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// progressDelay keeps the bar away from runs that are over quickly.
+	progressDelay = 250 * time.Millisecond
+	// progressInterval is how often the bar is redrawn at most.
+	progressInterval = 100 * time.Millisecond
+	progressWidth    = 30
+)
+
+// stderrBar is the progress bar of init. Logs go through it, so that it
+// makes way for them.
+var stderrBar = newProgressBar(os.Stderr)
+
+// progressBar draws the progress events of a run on one terminal line,
+// counting files and bytes while scanning and filling a bar while staging.
+type progressBar struct {
+	out   io.Writer
+	start time.Time
+	drawn time.Time
+	shown bool
+	// total and totalBytes are what Staging announced.
+	total      int
+	totalBytes int64
+}
+
+func newProgressBar(out io.Writer) *progressBar {
+	return &progressBar{out: out}
+}
+
+// showProgress reports whether init draws a progress bar: stderr is a
+// terminal showing text logs, and neither --quiet nor --verbose has other
+// plans for it.
+func showProgress() bool {
+	return !opts.Quiet && len(opts.Verbose) == 0 && opts.LogFormat == "text" && isTerminal(os.Stderr)
+}
+
+// event is the WithProgress callback.
+func (p *progressBar) event(e Event) {
+	now := time.Now()
+	switch e.Type {
+	case ScanStarted:
+		p.start = now
+		return
+	case Staging:
+		p.total, p.totalBytes = e.Files, e.Bytes
+	case Committed:
+		p.done()
+		return
+	}
+
+	if now.Sub(p.start) < progressDelay || now.Sub(p.drawn) < progressInterval {
+		return
+	}
+	p.drawn = now
+	p.shown = true
+
+	switch e.Type {
+	case FileCounted:
+		fmt.Fprintf(p.out, "\r\033[KScanning  %d files  %s", e.Files, formatSize(e.Bytes))
+	case Staging, FilesStaged:
+		fmt.Fprintf(p.out, "\r\033[KStaging   %s  %d/%d files  %s/%s",
+			bar(e.Files, p.total), e.Files, p.total, formatSize(e.Bytes), formatSize(p.totalBytes))
+	}
+}
+
+// done clears the bar, if it was drawn, for what is printed next.
+func (p *progressBar) done() {
+	if p.shown {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.shown = false
+	}
+}
+
+// Write clears the bar and writes b in its place; the next event
+// draws it again.
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.done()
+	return p.out.Write(b)
+}
+
+// bar renders n of total as a bar of progressWidth cells.
+func bar(n, total int) string {
+	filled := progressWidth
+	if total > 0 {
+		filled = min(progressWidth*n/total, progressWidth)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", progressWidth-filled) + "]"
+}
@@ -0,0 +1,178 @@
+package greenleeks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// prompt asks a question on stderr and returns the trimmed answer, or
+// fallback when the answer is empty.
+func prompt(question, fallback string) (string, error) {
+	if fallback != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", question, fallback)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", question)
+	}
+
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", err
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return fallback, nil
+	}
+
+	return answer, nil
+}
+
+func confirm(question string) (bool, error) {
+	answer, err := prompt(question+" [y/N]", "")
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// promptForIdentity asks for whatever part of ai is still a placeholder
+// and offers to save the answers to the global git config.
+func promptForIdentity(ai AuthorInfo) (AuthorInfo, error) {
+	fmt.Fprintln(os.Stderr, "No git identity found (user.name / user.email).")
+
+	for ai.Name == placeholderName || ai.Name == "" {
+		name, err := prompt("Name", "")
+		if err != nil {
+			return ai, err
+		}
+		ai.Name = name
+	}
+
+	for ai.Email == placeholderEmail || ai.Email == "" {
+		email, err := prompt("Email", "")
+		if err != nil {
+			return ai, err
+		}
+		ai.Email = email
+	}
+
+	path, err := globalConfigWritePath(opts.GitConfig)
+	if err != nil {
+		return ai, err
+	}
+
+	save, err := confirm(fmt.Sprintf("Save to %s?", path))
+	if err != nil || !save {
+		return ai, err
+	}
+
+	if err := writeIdentity(path, ai); err != nil {
+		return ai, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Saved identity to %s\n", path)
+
+	return ai, nil
+}
+
+func writeIdentity(path string, ai AuthorInfo) error {
+	return appendGitConfigSection(path, gitConfigUserSection, [][2]string{
+		{"name", ai.Name},
+		{"email", ai.Email},
+	})
+}
+
+// largestDirs is how many top-level directories promptFileLimit lists.
+const largestDirs = 5
+
+// promptFileLimit shows what pushed the directory over --max-files and
+// asks whether to continue anyway, exclude something or abort. It returns
+// the options to run again with, or nil to abort.
+func promptFileLimit(ctx context.Context, options []Option) ([]Option, error) {
+	i := New(options...)
+	plan, err := i.Plan(ctx, opts.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	// Nothing to ask about if the limit, as --force and --max-files set
+	// it, is not what failed.
+	if i.checkFileLimit(len(plan.Files)) == nil {
+		return nil, nil
+	}
+
+	counts := make(map[string]int)
+	for _, f := range plan.Files {
+		top, _, nested := strings.Cut(f.Path, "/")
+		if !nested {
+			top = "."
+		} else {
+			top += "/"
+		}
+		counts[top]++
+	}
+	dirs := make([]string, 0, len(counts))
+	for dir := range counts {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(a, b int) bool {
+		if counts[dirs[a]] != counts[dirs[b]] {
+			return counts[dirs[a]] > counts[dirs[b]]
+		}
+		return dirs[a] < dirs[b]
+	})
+
+	fmt.Fprintf(os.Stderr, "%d files to commit, --max-files is %d. Most of them are in:\n", len(plan.Files), i.maxFiles)
+	for _, dir := range dirs[:min(largestDirs, len(dirs))] {
+		fmt.Fprintf(os.Stderr, "  %6d  %s\n", counts[dir], dir)
+	}
+
+	// The largest directory is the likeliest thing to exclude.
+	suggestion := ""
+	for _, dir := range dirs {
+		if dir != "." {
+			suggestion = dir
+			break
+		}
+	}
+
+	for {
+		answer, err := prompt("[c]ontinue, [e]xclude a pattern or [a]bort", "a")
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(answer) {
+		case "c", "continue":
+			return []Option{WithUnlimitedFiles(true)}, nil
+		case "e", "exclude":
+			pattern, err := prompt("Pattern to exclude", suggestion)
+			if err != nil {
+				return nil, err
+			}
+			if pattern == "" {
+				continue
+			}
+			return []Option{WithExcludes(pattern)}, nil
+		case "a", "abort":
+			return nil, nil
+		}
+	}
+}
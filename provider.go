@@ -0,0 +1,93 @@
+package greenleeks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+const defaultRemoteName = "origin"
+
+// Provider creates repositories on a remote hosting service.
+type Provider interface {
+	// CreateRepository creates an empty repository called name and returns
+	// the remote it can be pushed to.
+	CreateRepository(ctx context.Context, name string, private bool) (*RemoteRepository, error)
+}
+
+// RemoteRepository describes a repository created by a Provider and how
+// to authenticate when pushing to it.
+type RemoteRepository struct {
+	CloneURL string
+	Auth     transport.AuthMethod
+	// RateLimit is what the API reported about its rate limit, if it did.
+	RateLimit *RateLimit
+}
+
+func newProvider(name, baseURL, token string) (Provider, error) {
+	switch name {
+	case "forgejo", "gitea":
+		return NewForgejoProvider(baseURL, token)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+}
+
+func (i *Initializer) publish(ctx context.Context, repo *git.Repository, rootDir string, tags bool) (*RemoteRepository, error) {
+	name := projectName(rootDir)
+
+	var remote *RemoteRepository
+	err := i.withRetries(ctx, "create remote repository", func() error {
+		var err error
+		remote, err = i.provider.CreateRepository(ctx, name, i.private)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote repository: %v", err)
+	}
+
+	i.logger.Info("created remote repository", "name", name, "url", remote.CloneURL)
+	if rl := remote.RateLimit; rl != nil {
+		level := slog.LevelDebug
+		if rl.low() {
+			level = slog.LevelWarn
+		}
+		i.logger.Log(ctx, level, "hosting api rate limit", "remaining", rl.Remaining, "limit", rl.Limit, "reset", rl.Reset)
+	}
+
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: defaultRemoteName,
+		URLs: []string{remote.CloneURL},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add remote: %v", err)
+	}
+
+	refSpecs := []config.RefSpec{"refs/heads/*:refs/heads/*"}
+	if tags {
+		refSpecs = append(refSpecs, config.RefSpec("refs/tags/*:refs/tags/*"))
+	}
+
+	err = i.withRetries(ctx, "push", func() error {
+		err := repo.PushContext(ctx, &git.PushOptions{
+			RemoteName: defaultRemoteName,
+			RefSpecs:   refSpecs,
+			Auth:       remote.Auth,
+		})
+		// An earlier attempt may have got through before failing.
+		if errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to push: %v", err)
+	}
+
+	return remote, nil
+}
@@ -0,0 +1,110 @@
+package greenleeks
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit is what a hosting API reported about its rate limit in the
+// X-RateLimit-* headers of its last answer.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	// Reset is when the limit is replenished; zero if not reported.
+	Reset time.Time
+}
+
+// low reports whether less than a tenth of the limit is left.
+func (r *RateLimit) low() bool {
+	return r.Remaining*10 < r.Limit
+}
+
+// parseRateLimit reads the X-RateLimit-* headers GitHub, GitLab and Gitea
+// send, and returns nil if there are none.
+func parseRateLimit(h http.Header) *RateLimit {
+	limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return nil
+	}
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return nil
+	}
+
+	r := &RateLimit{Limit: limit, Remaining: remaining}
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		r.Reset = time.Unix(reset, 0)
+	}
+	return r
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date.
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// rateLimitedProvider spaces the calls to a Provider evenly.
+type rateLimitedProvider struct {
+	Provider
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimitedProvider wraps p so that it is asked to create at most
+// perMinute repositories a minute, spacing the calls evenly. It is meant
+// for batch runs that share one provider across many Initializers, so
+// that a large batch does not trip the hosting service's abuse limits.
+func NewRateLimitedProvider(p Provider, perMinute int) Provider {
+	if perMinute <= 0 {
+		return p
+	}
+	return &rateLimitedProvider{Provider: p, interval: time.Minute / time.Duration(perMinute)}
+}
+
+func (p *rateLimitedProvider) CreateRepository(ctx context.Context, name string, private bool) (*RemoteRepository, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.Provider.CreateRepository(ctx, name, private)
+}
+
+// wait blocks until the caller's turn comes up.
+func (p *rateLimitedProvider) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	at := now
+	if p.next.After(now) {
+		at = p.next
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+
+	if !at.After(now) {
+		return nil
+	}
+
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
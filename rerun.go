@@ -0,0 +1,218 @@
+package greenleeks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// RerunMode selects what WithRerun does in a repository that holds
+// nothing but what an earlier Run committed.
+type RerunMode string
+
+const (
+	// RerunNone leaves such a repository alone with ErrAlreadyUnderGit.
+	RerunNone RerunMode = ""
+	// RerunAmend replaces the last commit Run made with one of everything
+	// now in the directory.
+	RerunAmend RerunMode = "amend"
+	// RerunAppend commits what changed since in a follow-up commit.
+	RerunAppend RerunMode = "append"
+)
+
+// reopen opens the existing repository of fs for WithResume or WithRerun,
+// returning ErrAlreadyUnderGit when neither applies to it. For WithRerun
+// the repository must hold nothing but what Run committed and must not
+// have been published; the mode is returned then, RerunNone for a
+// repository without commits.
+func (i *Initializer) reopen(fs billy.Filesystem) (*git.Repository, RerunMode, error) {
+	if !i.resume && i.rerun == RerunNone {
+		return nil, RerunNone, ErrAlreadyUnderGit
+	}
+
+	repo, err := openNested(fs, "")
+	if err != nil {
+		return nil, RerunNone, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	_, err = repo.Head()
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		if !i.resume {
+			return nil, RerunNone, ErrAlreadyUnderGit
+		}
+		i.logger.Info("Resuming in the existing repository, it has no commits yet.")
+		return repo, RerunNone, nil
+	case err != nil:
+		return nil, RerunNone, fmt.Errorf("failed to read HEAD: %w", err)
+	case i.rerun == RerunNone:
+		return nil, RerunNone, ErrAlreadyUnderGit
+	}
+
+	err = checkPristine(repo)
+	if err == nil {
+		err = checkUnpublished(repo)
+	}
+	if err != nil {
+		return nil, RerunNone, fmt.Errorf("cannot %s: %v", i.rerun, err)
+	}
+
+	i.logger.Info("Committing again in the repository an earlier run created.", "mode", i.rerun)
+	return repo, i.rerun, nil
+}
+
+// prepareRerun checks that there is something new to commit in the
+// repository reopened for WithRerun and, for RerunAmend, removes the tags
+// of the commit about to be replaced.
+func (i *Initializer) prepareRerun(repo *git.Repository, mode RerunMode) error {
+	same, err := unchanged(repo)
+	if err != nil {
+		return fmt.Errorf("failed to compare with HEAD: %w", err)
+	}
+	if same {
+		i.logger.Info("Nothing changed since the earlier run.")
+		return ErrAlreadyUnderGit
+	}
+
+	if mode == RerunAmend {
+		err = dropHeadTags(repo)
+		if err != nil {
+			return fmt.Errorf("failed to remove the tags of the amended commit: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkUnpublished fails if repo has a remote, to which the commits Run
+// made may have been pushed already.
+func checkUnpublished(repo *git.Repository) error {
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return err
+	}
+	if len(remotes) > 0 {
+		return fmt.Errorf("it has been published to %s, commit and push with git instead", remotes[0].Config().Name)
+	}
+	return nil
+}
+
+// dropHeadTags deletes the tags Run put on the commit HEAD points at,
+// which amending replaces, and takes them out of the record.
+func dropHeadTags(repo *git.Repository) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	section := cfg.Raw.Section(markerSection)
+	tags := section.OptionAll("tag")
+
+	var kept []string
+	for _, tag := range tags {
+		ref, err := repo.Tag(tag)
+		if errors.Is(err, git.ErrTagNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		target := ref.Hash()
+		if t, err := repo.TagObject(target); err == nil {
+			target = t.Target
+		}
+		if target != head.Hash() {
+			kept = append(kept, tag)
+			continue
+		}
+
+		if err := repo.DeleteTag(tag); err != nil {
+			return err
+		}
+	}
+
+	if len(kept) == len(tags) {
+		return nil
+	}
+	section.RemoveOption("tag")
+	for _, tag := range kept {
+		section.AddOption("tag", tag)
+	}
+	return repo.Storer.SetConfig(cfg)
+}
+
+// unchanged reports whether the index of repo holds exactly the tree of
+// HEAD, so that there is nothing new to commit.
+func unchanged(repo *git.Repository) (bool, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return false, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return false, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, err
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return false, err
+	}
+
+	entries := make(map[string]*index.Entry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		entries[e.Name] = e
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	files := 0
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+
+		files++
+		e, ok := entries[name]
+		if !ok || e.Hash != entry.Hash || e.Mode != entry.Mode {
+			return false, nil
+		}
+	}
+	return files == len(entries), nil
+}
+
+// validateRerun rejects option combinations WithRerun cannot honour.
+// Splitting builds the index of each commit from its group alone, which
+// on top of an existing commit would delete what that commit tracks.
+func (i *Initializer) validateRerun() error {
+	if i.rerun == RerunNone || i.splitBy == SplitNone && len(i.firstCommit) == 0 {
+		return nil
+	}
+	switch i.rerun {
+	case RerunAmend:
+		return errors.New("amending cannot be combined with splitting the import into several commits")
+	default:
+		return errors.New("appending cannot be combined with splitting the import into several commits")
+	}
+}
@@ -0,0 +1,98 @@
+package greenleeks
+
+import (
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+const shortHashLength = 7
+
+// Result describes the repository created by Initializer.Run.
+type Result struct {
+	// CommitHash is the full hash of the initial commit, the last one if
+	// WithSplitBy made several, or "" for a bare repository created without
+	// one.
+	CommitHash string `json:"commit_hash"`
+	// Branch is the short name of the branch HEAD points at.
+	Branch string `json:"branch"`
+	// Message is the commit message of CommitHash, trailers included.
+	Message string `json:"message"`
+	// Commits is the number of commits made.
+	Commits int `json:"commits"`
+	// RootCommit reports whether CommitHash has no parent, which it does
+	// not after WithSplitBy or WithRerun with RerunAppend.
+	RootCommit bool `json:"root_commit"`
+	// Tag is the tag pointing at the initial commit, if WithTag asked for
+	// one.
+	Tag string `json:"tag,omitempty"`
+	// FilesAdded is the number of files in the initial commit.
+	FilesAdded int `json:"files_added"`
+	// BinaryFiles is how many of FilesAdded git treats as binary.
+	BinaryFiles int `json:"binary_files"`
+	// CutOff lists the files and directories, with a trailing slash, that
+	// WithMaxDepth left out.
+	CutOff []string `json:"cut_off,omitempty"`
+	// NestedRepos lists the subdirectories that hold a repository of their
+	// own, which WithNestedRepos decided what to do with.
+	NestedRepos []string `json:"nested_repos,omitempty"`
+	// Skipped lists, sorted and with forward slashes, what was left out of
+	// the commit: what .gitignore, WithExcludes or SymlinksSkip matched,
+	// with ignored directories ending in a slash, the links SymlinksFollow
+	// could not follow and the binary files WithNoBinaries dropped.
+	Skipped []string `json:"skipped,omitempty"`
+	// FilesSkipped is the number of entries in Skipped. An ignored
+	// directory counts as one, since what is inside it is never looked at.
+	FilesSkipped int `json:"files_skipped"`
+	// Duration is how long Run took, in nanoseconds in JSON.
+	Duration time.Duration `json:"duration"`
+	// Phases breaks Duration down by the parts of Run.
+	Phases Phases `json:"phases"`
+}
+
+// Phases is how long the parts of Run took, in nanoseconds in JSON. A
+// part that did not happen is zero.
+type Phases struct {
+	// Scan is walking the directory for the files to commit.
+	Scan time.Duration `json:"scan"`
+	// Stage is adding them to the index.
+	Stage time.Duration `json:"stage"`
+	// Commit is creating the commits and the tag, the pre-commit hook
+	// included.
+	Commit time.Duration `json:"commit"`
+	// Push is creating the remote repository and pushing to it.
+	Push time.Duration `json:"push"`
+}
+
+// ShortHash returns the abbreviated commit hash, as git log --oneline
+// prints it.
+func (r *Result) ShortHash() string {
+	if len(r.CommitHash) > shortHashLength {
+		return r.CommitHash[:shortHashLength]
+	}
+	return r.CommitHash
+}
+
+// describeCommit fills in the parts of Result that are read back from the
+// new repository.
+func describeCommit(repo *git.Repository, result *Result) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	result.Branch = head.Name().Short()
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	result.RootCommit = commit.NumParents() == 0
+
+	index, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	result.FilesAdded = len(index.Entries)
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package greenleeks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// DefaultRetries is how many times WithRetries retries a failed call to
+// the hosting provider or push by default.
+const DefaultRetries = 3
+
+// retryBackoff is the wait before the first retry; it doubles for each
+// further one, up to maxRetryBackoff.
+var (
+	retryBackoff    = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+// StatusError is returned by a Provider when the hosting API answers with
+// an unexpected HTTP status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	// RetryAfter is how long the Retry-After header asks to wait, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return "api returned " + e.Status
+	}
+	return fmt.Sprintf("api returned %s: %s", e.Status, e.Message)
+}
+
+// withRetries calls fn until it succeeds, fails with an error that
+// isTransient does not accept, or has been retried WithRetries times,
+// backing off exponentially in between.
+func (i *Initializer) withRetries(ctx context.Context, what string, fn func() error) error {
+	wait := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= i.retries || !isTransient(err) {
+			return err
+		}
+
+		delay := wait
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+		}
+
+		i.logger.Warn("retrying after a transient failure", "step", what, "error", err, "wait", delay, "retry", attempt+1, "retries", i.retries)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		wait = min(2*wait, maxRetryBackoff)
+	}
+}
+
+// isTransient reports whether err is worth retrying: a network error, or
+// a 5xx or 429 answer from the hosting API or the git server.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return transientStatus(statusErr.StatusCode)
+	}
+
+	// go-git wraps HTTP transport failures without Unwrap.
+	var unexpected *plumbing.UnexpectedError
+	if errors.As(err, &unexpected) {
+		var httpErr *githttp.Err
+		if errors.As(unexpected.Err, &httpErr) {
+			return transientStatus(httpErr.StatusCode())
+		}
+		err = unexpected.Err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func transientStatus(code int) bool {
+	return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+}
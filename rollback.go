@@ -0,0 +1,114 @@
+package greenleeks
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+)
+
+// rollback collects the steps that take back what Run wrote, so that a
+// run failing before its commit leaves the directory as it found it.
+type rollback struct {
+	steps []func() error
+}
+
+func (r *rollback) add(step func() error) {
+	r.steps = append(r.steps, step)
+}
+
+// created arranges for paths in fs, about to be written, to be removed
+// again, along with any directory created for them. Paths that already
+// exist are left alone.
+func (r *rollback) created(fs billy.Filesystem, paths ...string) error {
+	for _, path := range paths {
+		top := ""
+		for dir := path; dir != "." && dir != ""; dir = filepath.Dir(dir) {
+			_, err := fs.Lstat(dir)
+			if err == nil {
+				break
+			}
+			if !os.IsNotExist(err) {
+				return err
+			}
+			top = dir
+		}
+		if top != "" {
+			r.add(func() error { return util.RemoveAll(fs, top) })
+		}
+	}
+	return nil
+}
+
+// replaced arranges for path in fs, about to be rewritten, to get its
+// current content back, or to be removed if it does not exist yet.
+func (r *rollback) replaced(fs billy.Filesystem, path string) error {
+	info, err := fs.Lstat(path)
+	if os.IsNotExist(err) {
+		return r.created(fs, path)
+	}
+	if err != nil {
+		return err
+	}
+
+	content, err := readFile(fs, path)
+	if err != nil {
+		return err
+	}
+	r.add(func() error { return util.WriteFile(fs, path, content, info.Mode().Perm()) })
+	return nil
+}
+
+// gitDir arranges for the repository about to be created in dot to be
+// removed. Whatever dot held before is kept; dot itself is removed if it
+// is on disk and did not exist.
+func (r *rollback) gitDir(dot billy.Filesystem) error {
+	entries, err := dot.ReadDir("")
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	before := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		before[e.Name()] = true
+	}
+
+	r.add(func() error {
+		current, err := dot.ReadDir("")
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range current {
+			if before[e.Name()] {
+				continue
+			}
+			if err := util.RemoveAll(dot, e.Name()); err != nil {
+				return err
+			}
+		}
+		if root, ok := diskRoot(dot); ok && !existed {
+			return os.Remove(root)
+		}
+		return nil
+	})
+	return nil
+}
+
+// run takes the steps back, newest first. A step that fails is logged and
+// the others still run.
+func (r *rollback) run(logger *slog.Logger) {
+	if len(r.steps) == 0 {
+		return
+	}
+	for n := len(r.steps) - 1; n >= 0; n-- {
+		if err := r.steps[n](); err != nil {
+			logger.Warn("failed to clean up after the failed run", "error", err)
+		}
+	}
+	logger.Info("Removed what the failed run had written.")
+}
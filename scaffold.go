@@ -0,0 +1,173 @@
+package greenleeks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+)
+
+const readmeFileName = "README.md"
+
+// scaffoldFile is a file greenleeks adds to the directory before the
+// initial commit. For a symlink, content holds the link target.
+type scaffoldFile struct {
+	path    string
+	content []byte
+	mode    os.FileMode
+}
+
+// scaffoldFiles returns the files the scaffolding options would add to
+// fs: the --from-template tree first, then README, .gitattributes and
+// LICENSE if neither the directory nor the template has one, and last a
+// .gitkeep in each empty directory. Dates in them come from date,
+// the commit date. Files that already exist are never replaced.
+func (i *Initializer) scaffoldFiles(ctx context.Context, fs billy.Filesystem, dir string, author AuthorInfo, date time.Time) ([]scaffoldFile, error) {
+	var files []scaffoldFile
+
+	if i.fromTemplate != "" {
+		data := newTemplateData(dir, author, date)
+		tmpl, err := i.remoteTemplateFiles(ctx, fs, i.fromTemplate, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch template %s: %w", i.fromTemplate, err)
+		}
+		files = append(files, tmpl...)
+	}
+
+	if i.scaffoldReadme {
+		exists, err := hasTopLevelFile(fs, files, "README")
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			files = append(files, scaffoldFile{
+				path:    readmeFileName,
+				content: readmeContent(projectName(dir), date),
+			})
+		}
+	}
+
+	if i.gitattributes {
+		f, err := gitattributesScaffold(fs, files)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			files = append(files, *f)
+		}
+	}
+
+	if i.license != "" {
+		f, err := i.licenseFile(fs, files, author, date)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			files = append(files, *f)
+		}
+	}
+
+	if i.keepEmptyDirs {
+		gitkeeps, err := i.gitkeepFiles(ctx, fs, files)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look for empty directories: %w", err)
+		}
+		files = append(files, gitkeeps...)
+	}
+
+	return files, nil
+}
+
+// writeScaffold writes files into fs.
+func (i *Initializer) writeScaffold(fs billy.Filesystem, files []scaffoldFile) error {
+	for _, f := range files {
+		if f.mode&os.ModeSymlink != 0 {
+			if err := fs.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+				return err
+			}
+			if err := fs.Symlink(string(f.content), f.path); err != nil {
+				return err
+			}
+			i.logger.Info("scaffolded file", "path", f.path)
+			continue
+		}
+
+		mode := f.mode.Perm()
+		if mode == 0 {
+			mode = 0o644
+		}
+		if err := util.WriteFile(fs, f.path, f.content, mode); err != nil {
+			return err
+		}
+		i.logger.Info("scaffolded file", "path", f.path)
+	}
+	return nil
+}
+
+// hasScaffold reports whether files includes name.
+func hasScaffold(files []scaffoldFile, name string) bool {
+	for _, f := range files {
+		if f.path == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTopLevelFile reports whether fs, or the scaffold files about to be
+// written to it, has a top-level file whose name starts with any of
+// prefixes, ignoring case and extension.
+func hasTopLevelFile(fs billy.Filesystem, pending []scaffoldFile, prefixes ...string) (bool, error) {
+	entries, err := fs.ReadDir("")
+	if err != nil {
+		return false, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	for _, f := range pending {
+		if !strings.ContainsRune(filepath.ToSlash(f.path), '/') {
+			names = append(names, f.path)
+		}
+	}
+
+	for _, name := range names {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(strings.ToUpper(name), prefix) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func readmeContent(name string, created time.Time) []byte {
+	return []byte(fmt.Sprintf("# %s\n\nCreated %s.\n", name, created.Format("2006-01-02")))
+}
+
+// projectName is the base name of dir once made absolute, so that "."
+// names the current directory.
+func projectName(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return filepath.Base(dir)
+}
+
+// plannedScaffold turns scaffold files into plan entries.
+func plannedScaffold(files []scaffoldFile) []PlannedFile {
+	planned := make([]PlannedFile, 0, len(files))
+	for _, f := range files {
+		planned = append(planned, PlannedFile{Path: filepath.ToSlash(f.path), Size: int64(len(f.content))})
+	}
+	return planned
+}
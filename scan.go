@@ -0,0 +1,599 @@
+package greenleeks
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+const (
+	gitignoreFile = ".gitignore"
+
+	// stageBatchSize is how many files stageFiles adds between progress
+	// reports.
+	stageBatchSize = 500
+)
+
+// scanWorkers is how many directories a scan reads at once. Scanning
+// waits on the disk far more than on the CPU, so it does not stop at the
+// number of cores.
+var scanWorkers = max(8, runtime.NumCPU())
+
+// scannedFile is a file a scan found to stage, with the Lstat result
+// its index entry is filled from.
+type scannedFile struct {
+	path string
+	info os.FileInfo
+	// commit, if set, makes this a nested repository to be staged as a
+	// gitlink to that commit; info is unset then.
+	commit plumbing.Hash
+	// binary is set for a regular file that git treats as binary, when the
+	// scan looked.
+	binary bool
+}
+
+// size is the number of bytes f takes up in the work tree, zero for a
+// gitlink.
+func (f scannedFile) size() int64 {
+	if f.info == nil {
+		return 0
+	}
+	return f.info.Size()
+}
+
+// totalSize adds up the sizes of files.
+func totalSize(files []scannedFile) int64 {
+	var n int64
+	for _, f := range files {
+		n += f.size()
+	}
+	return n
+}
+
+// scanner walks a work tree the way git add does, skipping .git and what
+// .gitignore files or excludes match, and reads several directories at a
+// time. It makes a single pass that yields the file count, the files to
+// stage and what WithMaxDepth cuts off, and only stats the files it keeps.
+type scanner struct {
+	fs billy.Filesystem
+	// excludes win over .gitignore, as info/exclude and WithExcludes do in
+	// go-git.
+	excludes []gitignore.Pattern
+	// limit stops the scan with a TooManyFilesError once more files than
+	// this are found. Zero means no limit.
+	limit int
+	// maxDepth cuts off files deeper than this, counting top-level files as
+	// depth 1. Zero means no limit.
+	maxDepth int
+	// skipLinks leaves symlinks out, as SymlinksSkip does, so that they
+	// do not count towards limit.
+	skipLinks bool
+	// skipHidden leaves hidden files and directories out, as
+	// WithExcludeHidden does. It is checked apart from the patterns, so that
+	// it can only leave out more and never brings back what .gitignore
+	// matched.
+	skipHidden bool
+	// classify sniffs every regular file for whether git treats it as
+	// binary.
+	classify bool
+	// skipBinaries leaves binary files out, as WithNoBinaries does, so that
+	// they do not count towards limit. It implies classify.
+	skipBinaries bool
+	// found, if set, is called for every file found, one call at a time,
+	// with the number found so far.
+	found func(path string, n int, bytes int64)
+}
+
+// scanResult is what a scan found.
+type scanResult struct {
+	// files are the files to stage, sorted by path.
+	files []scannedFile
+	// skipped lists, sorted and with forward slashes, the files and
+	// directories that were left out. An ignored directory ends in a slash
+	// and is listed once, as it is not descended into.
+	skipped []string
+	// cutOff lists, sorted and with forward slashes, the files and
+	// directories just below maxDepth. Directories end in a slash.
+	cutOff []string
+	// nested lists, sorted, the directories that hold a repository of their
+	// own. They are not descended into.
+	nested []string
+	// binaries lists, sorted and with forward slashes, the binary files
+	// skipBinaries left out. They are in skipped as well.
+	binaries []string
+}
+
+// scanEntry is what the directory readers report to the collector: a file
+// to stage, something that was left out, something below maxDepth, a
+// nested repository, or a binary file that was left out.
+type scanEntry struct {
+	file    scannedFile
+	skipped string
+	cut     string
+	nested  string
+	binary  string
+}
+
+// lazyWriter is implemented by the filesystem object storage, which can
+// write an object of known size straight to disk.
+type lazyWriter interface {
+	LazyWriter() (io.WriteCloser, func(plumbing.ObjectType, int64) error, error)
+}
+
+// streamBlob stores the size bytes read from r as a blob. Where the storage
+// allows it they are written through to the object file rather than held
+// in memory first, so that large files do not each cost their size in RSS.
+func streamBlob(repo *git.Repository, r io.Reader, size int64) (plumbing.Hash, error) {
+	lw, ok := repo.Storer.(lazyWriter)
+	if !ok {
+		obj := repo.Storer.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		w, err := obj.Writer()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			w.Close()
+			return plumbing.ZeroHash, err
+		}
+		if err := w.Close(); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		return repo.Storer.SetEncodedObject(obj)
+	}
+
+	w, writeHeader, err := lw.LazyWriter()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := writeHeader(plumbing.BlobObject, size); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	hasher := plumbing.NewHasher(plumbing.BlobObject, size)
+	if _, err := io.CopyN(io.MultiWriter(w, hasher), r, size); err != nil {
+		w.Close()
+		if errors.Is(err, io.EOF) {
+			err = errors.New("file shrank while being staged")
+		}
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return hasher.Sum(), nil
+}
+
+// scanDir is a directory waiting to be read, with the .gitignore patterns
+// that apply to it.
+type scanDir struct {
+	path     string
+	patterns []gitignore.Pattern
+}
+
+// scan walks the work tree.
+func (s *scanner) scan(ctx context.Context) (*scanResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		scanErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			scanErr = err
+			cancel()
+		})
+	}
+
+	entries := make(chan scanEntry, 256)
+	sem := make(chan struct{}, scanWorkers)
+
+	var walk func(dir scanDir)
+	walk = func(dir scanDir) {
+		defer wg.Done()
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(ctx.Err())
+			return
+		}
+		subdirs, err := s.readDir(ctx, dir, entries)
+		<-sem
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		for _, sub := range subdirs {
+			wg.Add(1)
+			go walk(sub)
+		}
+	}
+
+	wg.Add(1)
+	go walk(scanDir{})
+	go func() {
+		wg.Wait()
+		close(entries)
+	}()
+
+	// A directory read can hang on a network filesystem, and is not
+	// interrupted by ctx, so the result is not waited for once ctx is done;
+	// a stuck reader goroutine is left to finish on its own.
+	result := &scanResult{}
+	var bytes int64
+collect:
+	for {
+		var e scanEntry
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				break collect
+			}
+			e = entry
+		case <-ctx.Done():
+			// Once fail returns, scanErr is set, by this call or an
+			// earlier one.
+			fail(ctx.Err())
+			break collect
+		}
+
+		switch {
+		case e.skipped != "":
+			result.skipped = append(result.skipped, e.skipped)
+			continue
+		case e.cut != "":
+			result.cutOff = append(result.cutOff, e.cut)
+			continue
+		case e.nested != "":
+			result.nested = append(result.nested, e.nested)
+			continue
+		case e.binary != "":
+			result.skipped = append(result.skipped, e.binary)
+			result.binaries = append(result.binaries, e.binary)
+			continue
+		}
+
+		result.files = append(result.files, e.file)
+		n := len(result.files)
+		bytes += e.file.size()
+		if s.limit > 0 && n > s.limit {
+			fail(&TooManyFilesError{Count: n, Limit: s.limit})
+			continue
+		}
+		if s.found != nil {
+			s.found(e.file.path, n, bytes)
+		}
+	}
+
+	// Safe to read: the loop ends either on entries being closed, after
+	// every fail, or on a fail of its own.
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	files := result.files
+	sort.Slice(files, func(a, b int) bool {
+		return filepath.ToSlash(files[a].path) < filepath.ToSlash(files[b].path)
+	})
+	sort.Strings(result.skipped)
+	sort.Strings(result.cutOff)
+	sort.Strings(result.nested)
+	sort.Strings(result.binaries)
+	return result, nil
+}
+
+// slashPath returns path with forward slashes and, for a directory, a
+// trailing one.
+func slashPath(path string, isDir bool) string {
+	path = filepath.ToSlash(path)
+	if isDir {
+		path += "/"
+	}
+	return path
+}
+
+// scan runs s, giving up after WithScanTimeout.
+func (i *Initializer) scan(ctx context.Context, s *scanner) (*scanResult, error) {
+	if i.scanTimeout <= 0 {
+		return s.scan(ctx)
+	}
+
+	scanCtx, cancel := context.WithTimeout(ctx, i.scanTimeout)
+	defer cancel()
+
+	result, err := s.scan(scanCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, fmt.Errorf("%w after %v", ErrScanTimeout, i.scanTimeout)
+	}
+	return result, err
+}
+
+// readDir reports the entries of dir to entries and returns its
+// subdirectories that are to be read in turn.
+func (s *scanner) readDir(ctx context.Context, dir scanDir, entries chan<- scanEntry) ([]scanDir, error) {
+	dirEntries, err := s.readDirEntries(dir.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var domain []string
+	if dir.path != "" {
+		domain = strings.Split(dir.path, string(filepath.Separator))
+
+		// A .git directory or file below the top makes this a repository
+		// of its own, which is reported rather than walked.
+		for _, d := range dirEntries {
+			if d.Name() != git.GitDirName {
+				continue
+			}
+			select {
+			case entries <- scanEntry{nested: filepath.ToSlash(dir.path)}:
+				return nil, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	patterns, err := readGitignore(s.fs, dir.path, domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) > 0 {
+		patterns = append(dir.patterns[:len(dir.patterns):len(dir.patterns)], patterns...)
+	} else {
+		patterns = dir.patterns
+	}
+	matcher := gitignore.NewMatcher(append(patterns[:len(patterns):len(patterns)], s.excludes...))
+
+	var subdirs []scanDir
+	for _, d := range dirEntries {
+		if d.Name() == git.GitDirName {
+			continue
+		}
+
+		path := filepath.Join(dir.path, d.Name())
+		var e scanEntry
+		switch {
+		case matcher.Match(append(domain[:len(domain):len(domain)], d.Name()), d.IsDir()),
+			s.skipLinks && d.Type()&iofs.ModeSymlink != 0,
+			s.skipHidden && isHidden(d.Name()):
+			e.skipped = slashPath(path, d.IsDir())
+		case s.maxDepth > 0 && len(domain) >= s.maxDepth:
+			e.cut = slashPath(path, d.IsDir())
+		case d.IsDir():
+			subdirs = append(subdirs, scanDir{path: path, patterns: patterns})
+			continue
+		default:
+			info, err := d.Info()
+			if err != nil {
+				return nil, err
+			}
+			binary := false
+			if (s.classify || s.skipBinaries) && info.Mode().IsRegular() {
+				binary, err = isBinaryFile(s.fs, path)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if binary && s.skipBinaries {
+				e.binary = slashPath(path, false)
+			} else {
+				e.file = scannedFile{path: path, info: info, binary: binary}
+			}
+		}
+
+		select {
+		case entries <- e:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return subdirs, nil
+}
+
+// readDirEntries lists dir. On disk it goes to os.ReadDir, whose entries
+// know whether they are directories without a stat per entry; other
+// filesystems only offer ReadDir with a FileInfo each.
+func (s *scanner) readDirEntries(dir string) ([]iofs.DirEntry, error) {
+	if root, ok := diskRoot(s.fs); ok {
+		return os.ReadDir(filepath.Join(root, dir))
+	}
+
+	infos, err := s.fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]iofs.DirEntry, len(infos))
+	for n, info := range infos {
+		entries[n] = iofs.FileInfoToDirEntry(info)
+	}
+	return entries, nil
+}
+
+// diskRoot returns the directory on disk that fs, an osfs filesystem or a
+// chroot of one, stands for.
+func diskRoot(fs billy.Filesystem) (string, bool) {
+	if b, ok := fs.(*osfs.BoundOS); ok {
+		return b.Root(), true
+	}
+
+	// osfs.New wraps ChrootOS in a chroot and a polyfill.
+	var u billy.Basic = fs
+	for {
+		w, ok := u.(interface{ Underlying() billy.Basic })
+		if !ok {
+			return "", false
+		}
+		u = w.Underlying()
+		if _, ok := u.(*osfs.ChrootOS); ok {
+			return fs.Root(), true
+		}
+	}
+}
+
+// readGitignore parses the .gitignore in dir, if there is one, with its
+// patterns scoped to domain.
+func readGitignore(fs billy.Filesystem, dir string, domain []string) ([]gitignore.Pattern, error) {
+	f, err := fs.Open(filepath.Join(dir, gitignoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []gitignore.Pattern
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		line := lines.Text()
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, domain))
+	}
+	return patterns, lines.Err()
+}
+
+// stageFiles replaces the index of repo with files, storing their
+// contents as blobs, as git add would. Each blob is streamed, so no file is
+// held in memory whole, but the index is: every entry is kept until the
+// single write at the end, as go-git encodes the index in one piece, so
+// memory still grows with the number of files. The batches of
+// stageBatchSize only pace progress; staged, if set, is called after each
+// with the number staged so far.
+func stageFiles(ctx context.Context, repo *git.Repository, fs billy.Filesystem, files []scannedFile, staged func(n int, bytes int64)) error {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	entries := make([]*index.Entry, 0, len(files))
+	var bytes int64
+	for start := 0; start < len(files); start += stageBatchSize {
+		for _, f := range files[start:min(start+stageBatchSize, len(files))] {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if !f.commit.IsZero() {
+				entries = append(entries, &index.Entry{
+					Name: filepath.ToSlash(f.path),
+					Hash: f.commit,
+					Mode: filemode.Submodule,
+				})
+				continue
+			}
+
+			e, err := indexEntry(fs, repo, f.path, f.info)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, e)
+			bytes += f.size()
+		}
+		if staged != nil {
+			staged(len(entries), bytes)
+		}
+	}
+
+	idx.Entries = entries
+	return repo.Storer.SetIndex(idx)
+}
+
+// indexEntry stores the contents of path, or the target of a symlink, as
+// a blob and returns an index entry for it carrying the stat data of info.
+func indexEntry(fs billy.Filesystem, repo *git.Repository, path string, info os.FileInfo) (*index.Entry, error) {
+	mode, err := filemode.NewFromOSFileMode(info.Mode())
+	if err != nil {
+		return nil, err
+	}
+
+	var hash plumbing.Hash
+	if mode == filemode.Symlink {
+		target, err := readlink(fs, path)
+		if err != nil {
+			return nil, err
+		}
+		hash, err = storeBlob(repo, []byte(filepath.ToSlash(target)))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := fs.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		hash, err = streamBlob(repo, f, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	e := &index.Entry{
+		Name:       filepath.ToSlash(path),
+		Hash:       hash,
+		Mode:       mode,
+		Size:       uint32(info.Size()),
+		CreatedAt:  info.ModTime(),
+		ModifiedAt: info.ModTime(),
+	}
+	fillStat(e, info)
+	return e, nil
+}
+
+// readlink returns the target of the symlink path as git add stores it.
+// On disk that is what os.Readlink says, since the chroot of osfs turns an
+// absolute target into one relative to the work tree.
+func readlink(fs billy.Filesystem, path string) (string, error) {
+	if root, ok := diskRoot(fs); ok {
+		return os.Readlink(filepath.Join(root, path))
+	}
+	return fs.Readlink(path)
+}
+
+// gitFiles are the hidden names WithExcludeHidden keeps, those git and the
+// forges read. Anything else starting with .git, .git-credentials or
+// .gitconfig.local say, is as likely as any dotfile to hold a secret.
+var gitFiles = map[string]bool{
+	".gitattributes": true,
+	".github":        true,
+	".gitignore":     true,
+	".gitkeep":       true,
+	".gitlab":        true,
+	".gitlab-ci.yml": true,
+	".gitmodules":    true,
+}
+
+// isHidden reports whether WithExcludeHidden leaves name out: it starts
+// with a dot, and is not one of gitFiles.
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && !gitFiles[name]
+}
@@ -0,0 +1,65 @@
+package greenleeks
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+)
+
+func TestDiskRoot(t *testing.T) {
+	dir := t.TempDir()
+	chroot := func(fs billy.Filesystem) billy.Filesystem {
+		sub, err := fs.Chroot("sub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sub
+	}
+
+	tests := []struct {
+		name   string
+		fs     billy.Filesystem
+		want   string
+		wantOK bool
+	}{
+		{"osfs", osfs.New(dir), dir, true},
+		{"bound osfs", osfs.New(dir, osfs.WithBoundOS()), dir, true},
+		{"chroot of osfs", chroot(osfs.New(dir)), filepath.Join(dir, "sub"), true},
+		{"memfs", memfs.New(), "", false},
+		{"chroot of memfs", chroot(memfs.New()), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := diskRoot(tt.fs)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("diskRoot = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIsHidden(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"README.md", false},
+		{".gitignore", false},
+		{".gitattributes", false},
+		{".github", false},
+		{".gitlab-ci.yml", false},
+		{".idea", true},
+		{".env", true},
+		{".git-credentials", true},
+		{".gitconfig.local", true},
+	}
+	for _, tt := range tests {
+		if got := isHidden(tt.name); got != tt.want {
+			t.Errorf("isHidden(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package greenleeks
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+const (
+	releaseRepository = "taylormonacelli/greenleeks"
+	checksumsAsset    = "checksums.txt"
+	maxReleaseAsset   = 100 << 20
+)
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *githubRelease) assetURL(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+// runSelfUpdate replaces the running binary with the latest GitHub release
+// for this platform, after checking it against the release's checksums.
+// Only a newer release is installed; a build that is not a release, such
+// as a development build, is replaced only with --force.
+func runSelfUpdate() error {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+
+	release, err := latestRelease(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to look up the latest release: %v", err)
+	}
+
+	current := ReadBuildInfo().Version
+	if !semver.IsValid(release.TagName) {
+		return fmt.Errorf("the latest release %q is not a semantic version", release.TagName)
+	}
+	switch {
+	case !semver.IsValid(current) && !opts.SelfUpdate.Force:
+		return fmt.Errorf("running %q, which is not a release, pass --force to install %s anyway", current, release.TagName)
+	case !semver.IsValid(current):
+	case semver.Compare(release.TagName, current) <= 0:
+		fmt.Printf("%s %s is up to date, the latest release is %s\n", programName, current, release.TagName)
+		return nil
+	}
+
+	if opts.SelfUpdate.Check {
+		fmt.Printf("%s %s is available (running %s)\n", programName, release.TagName, current)
+		return nil
+	}
+
+	archive := releaseArchiveName(release.TagName, runtime.GOOS, runtime.GOARCH)
+	archiveURL, ok := release.assetURL(archive)
+	if !ok {
+		return fmt.Errorf("release %s has no %s", release.TagName, archive)
+	}
+	checksumsURL, ok := release.assetURL(checksumsAsset)
+	if !ok {
+		return fmt.Errorf("release %s has no %s", release.TagName, checksumsAsset)
+	}
+
+	checksums, err := download(ctx, client, checksumsURL)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %v", checksumsAsset, err)
+	}
+
+	data, err := download(ctx, client, archiveURL)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %v", archive, err)
+	}
+
+	if err := verifyChecksum(checksums, archive, data); err != nil {
+		return err
+	}
+
+	binary, err := extractBinary(archive, data)
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %v", archive, err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceExecutable(exe, binary); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", exe, err)
+	}
+
+	slog.Info("updated", "from", current, "to", release.TagName, "path", exe)
+	fmt.Printf("updated %s to %s\n", programName, release.TagName)
+
+	return nil
+}
+
+func latestRelease(ctx context.Context, client *http.Client) (*githubRelease, error) {
+	url := "https://api.github.com/repos/" + releaseRepository + "/releases/latest"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("github api returned %s", resp.Status)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+func download(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxReleaseAsset))
+}
+
+// releaseArchiveName follows goreleaser's default archive naming.
+func releaseArchiveName(tag, goos, goarch string) string {
+	ext := ".tar.gz"
+	if goos == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf("%s_%s_%s_%s%s", programName, strings.TrimPrefix(tag, "v"), goos, goarch, ext)
+}
+
+// verifyChecksum checks data against its line in a sha256sum style
+// checksums file.
+func verifyChecksum(checksums []byte, name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	got := hex.EncodeToString(sum[:])
+
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		if !strings.EqualFold(fields[0], got) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, fields[0], got)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%s is not listed in %s", name, checksumsAsset)
+}
+
+func extractBinary(archive string, data []byte) ([]byte, error) {
+	want := programName
+	if strings.HasSuffix(archive, ".zip") {
+		want += ".exe"
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if path.Base(f.Name) != want {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(io.LimitReader(rc, maxReleaseAsset))
+		}
+		return nil, fmt.Errorf("%s not found in archive", want)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in archive", want)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == want {
+			return io.ReadAll(io.LimitReader(tr, maxReleaseAsset))
+		}
+	}
+}
+
+// replaceExecutable writes binary next to exe and renames it into place.
+// Windows will not overwrite a running executable, so the old one is moved
+// aside first.
+func replaceExecutable(exe string, binary []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".new-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), exe)
+}
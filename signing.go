@@ -0,0 +1,259 @@
+package greenleeks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	mymazda "github.com/taylormonacelli/forestfish/mymazda"
+)
+
+const (
+	defaultGPGProgram     = "gpg"
+	defaultSSHProgram     = "ssh-keygen"
+	sshLiteralKeyPrefix   = "key::"
+	sshSignatureNamespace = "git"
+)
+
+// signingConfig holds whatever is needed to sign the boilerplate commit.
+// Exactly one of key and signer is set.
+type signingConfig struct {
+	key    *openpgp.Entity
+	signer git.Signer
+}
+
+func (s *signingConfig) apply(o *git.CommitOptions) {
+	if s == nil {
+		return
+	}
+	o.SignKey = s.key
+	o.Signer = s.signer
+}
+
+// gpgSigner signs through the gpg binary, and therefore gpg-agent, the same
+// way git itself does.
+type gpgSigner struct {
+	program string
+	keyID   string
+}
+
+func (s *gpgSigner) Sign(message io.Reader) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(s.program, "--status-fd=2", "-bsau", s.keyID)
+	cmd.Stdin = message
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed to sign the data: %v: %s", s.program, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// sshSigner signs with ssh-keygen -Y sign, which is what git runs when
+// gpg.format is ssh. A public key works too when the private half lives in
+// ssh-agent.
+type sshSigner struct {
+	program    string
+	signingKey string
+}
+
+func (s *sshSigner) Sign(message io.Reader) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	keyFile, cleanup, err := sshKeyFile(s.signingKey)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := exec.Command(s.program, "-Y", "sign", "-n", sshSignatureNamespace, "-f", keyFile)
+	cmd.Stdin = message
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed to sign the data: %v: %s", s.program, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (i *Initializer) configureSigning(config *gitConfig, ai AuthorInfo) (*signingConfig, error) {
+	gpgSign := config.getBool("commit", "", "gpgsign", false)
+
+	switch {
+	case i.signMode == SignNever:
+		return nil, nil
+	case i.signMode == SignAlways, i.sshSigningKey != "":
+	case gpgSign && i.reproducible:
+		i.logger.Info("not signing: commit.gpgsign is ignored in reproducible mode")
+		return nil, nil
+	case gpgSign:
+		i.logger.Debug("signing commit because commit.gpgsign is set")
+	default:
+		return nil, nil
+	}
+
+	keyID := config.get(gitConfigUserSection, "", "signingkey")
+
+	format := config.get("gpg", "", "format")
+	if i.sshSigningKey != "" {
+		format = "ssh"
+		keyID = i.sshSigningKey
+	}
+
+	switch format {
+	case "", "openpgp":
+	case "ssh":
+		return configureSSHSigning(config.get("gpg", "ssh", "program"), keyID)
+	default:
+		return nil, fmt.Errorf("unsupported gpg.format %q", format)
+	}
+
+	if keyID == "" {
+		keyID = fmt.Sprintf("%s <%s>", ai.Name, ai.Email)
+	}
+
+	if i.signingKeyring != "" {
+		entity, err := loadSigningEntity(i.signingKeyring, keyID)
+		if err != nil {
+			return nil, err
+		}
+		return &signingConfig{key: entity}, nil
+	}
+
+	program := config.get("gpg", "", "program")
+	if program == "" {
+		program = defaultGPGProgram
+	}
+
+	if err := requireProgram(program); err != nil {
+		return nil, err
+	}
+
+	return &signingConfig{signer: &gpgSigner{program: program, keyID: keyID}}, nil
+}
+
+func configureSSHSigning(program, signingKey string) (*signingConfig, error) {
+	if signingKey == "" {
+		return nil, fmt.Errorf("ssh signing requires user.signingkey or --ssh-signing-key")
+	}
+	if program == "" {
+		program = defaultSSHProgram
+	}
+
+	if err := requireProgram(program); err != nil {
+		return nil, err
+	}
+
+	return &signingConfig{signer: &sshSigner{program: program, signingKey: signingKey}}, nil
+}
+
+// requireProgram fails up front rather than after the repository has been
+// initialized, since an unsigned commit is not an acceptable fallback.
+func requireProgram(program string) error {
+	if _, err := exec.LookPath(program); err != nil {
+		return fmt.Errorf("commit signing requires %s, which was not found: %v", program, err)
+	}
+	return nil
+}
+
+// sshKeyFile returns a path ssh-keygen can read. Like git, user.signingkey
+// may hold the public key itself rather than a path, in which case it is
+// written to a temporary file.
+func sshKeyFile(signingKey string) (string, func(), error) {
+	noop := func() {}
+
+	literal := strings.TrimPrefix(signingKey, sshLiteralKeyPrefix)
+	if literal == signingKey && !strings.HasPrefix(signingKey, "ssh-") {
+		path, err := mymazda.ExpandTilde(signingKey)
+		return path, noop, err
+	}
+
+	f, err := os.CreateTemp("", "greenleeks-signingkey-*.pub")
+	if err != nil {
+		return "", noop, err
+	}
+	defer f.Close()
+
+	cleanup := func() { os.Remove(f.Name()) }
+	if _, err := f.WriteString(literal + "\n"); err != nil {
+		cleanup()
+		return "", noop, err
+	}
+
+	return f.Name(), cleanup, nil
+}
+
+func loadSigningEntity(keyringPath, keyID string) (*openpgp.Entity, error) {
+	path, err := mymazda.ExpandTilde(keyringPath)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %v", err)
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keyring %s: %v", path, err)
+	}
+
+	for _, entity := range entities {
+		if !entityMatches(entity, keyID) {
+			continue
+		}
+		if entity.PrivateKey == nil {
+			return nil, fmt.Errorf("keyring %s has no secret key for %s", path, keyID)
+		}
+		if entity.PrivateKey.Encrypted {
+			return nil, fmt.Errorf("secret key for %s is passphrase-protected, sign through gpg-agent instead", keyID)
+		}
+		return entity, nil
+	}
+
+	return nil, fmt.Errorf("no key matching %s in %s", keyID, path)
+}
+
+// entityMatches accepts the same key specifications git passes to gpg -u:
+// a (possibly 0x-prefixed) key id or fingerprint, or a user id.
+func entityMatches(entity *openpgp.Entity, keyID string) bool {
+	want := strings.ToUpper(strings.TrimPrefix(keyID, "0x"))
+
+	ids := []string{
+		fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint),
+		fmt.Sprintf("%016X", entity.PrimaryKey.KeyId),
+	}
+	for _, subkey := range entity.Subkeys {
+		ids = append(ids,
+			fmt.Sprintf("%X", subkey.PublicKey.Fingerprint),
+			fmt.Sprintf("%016X", subkey.PublicKey.KeyId),
+		)
+	}
+	for _, id := range ids {
+		if len(want) >= 8 && strings.HasSuffix(id, want) {
+			return true
+		}
+	}
+
+	for name, identity := range entity.Identities {
+		if name == keyID || (identity.UserId != nil && identity.UserId.Email == keyID) {
+			return true
+		}
+	}
+
+	return false
+}
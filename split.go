@@ -0,0 +1,193 @@
+package greenleeks
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// SplitMode selects how WithSplitBy groups files into commits.
+type SplitMode string
+
+const (
+	// SplitNone makes a single initial commit.
+	SplitNone SplitMode = ""
+	// SplitByDir commits the files at the top level first, then each
+	// top-level directory on its own, in name order.
+	SplitByDir SplitMode = "dir"
+	// SplitByType commits documentation, configuration, source code,
+	// assets and everything else separately, in that order, going by file
+	// name and extension.
+	SplitByType SplitMode = "type"
+)
+
+// File type groups for SplitByType, in commit order.
+var fileTypes = []string{"documentation", "configuration", "source files", "assets", "other files"}
+
+var extensionTypes = map[string]string{}
+
+func init() {
+	for fileType, extensions := range map[string][]string{
+		"documentation": {".adoc", ".markdown", ".md", ".org", ".rst", ".txt"},
+		"configuration": {".cfg", ".conf", ".env", ".ini", ".json", ".lock", ".properties", ".sum", ".toml", ".xml", ".yaml", ".yml"},
+		"source files": {".bash", ".c", ".cc", ".cpp", ".cs", ".css", ".go", ".h", ".hpp", ".html", ".java", ".js", ".jsx", ".kt",
+			".lua", ".m", ".php", ".pl", ".ps1", ".py", ".rb", ".rs", ".scala", ".scss", ".sh", ".sql", ".swift", ".ts", ".tsx", ".vue", ".zsh"},
+		"assets": {".bmp", ".eot", ".gif", ".gz", ".ico", ".jpeg", ".jpg", ".mov", ".mp3", ".mp4", ".ogg", ".otf", ".pdf", ".png",
+			".psd", ".svg", ".tar", ".tiff", ".ttf", ".wav", ".webm", ".webp", ".woff", ".woff2", ".zip"},
+	} {
+		for _, ext := range extensions {
+			extensionTypes[ext] = fileType
+		}
+	}
+}
+
+// fileType classifies name for SplitByType. Well-known names without a
+// telling extension are matched by name.
+func fileType(name string) string {
+	base := path.Base(name)
+	upper := strings.ToUpper(base)
+	for _, prefix := range []string{"README", "LICENSE", "LICENCE", "COPYING", "CHANGELOG", "CONTRIBUTING", "AUTHORS", "NOTICE"} {
+		if strings.HasPrefix(upper, prefix) {
+			return "documentation"
+		}
+	}
+
+	switch base {
+	case "Makefile", "Dockerfile", "Containerfile", "Vagrantfile", "Gemfile", "Procfile", "go.mod",
+		".gitignore", ".gitattributes", ".editorconfig", ".dockerignore":
+		return "configuration"
+	}
+
+	if fileType, ok := extensionTypes[strings.ToLower(path.Ext(base))]; ok {
+		return fileType
+	}
+	return "other files"
+}
+
+// commitGroup is a set of staged files committed together.
+type commitGroup struct {
+	label   string
+	entries []*index.Entry
+}
+
+// commitAll commits what is staged in repo, in one commit or, with
+// WithSplitBy, one per group, each adding to the tree of the one before.
+// It returns the hash and message of the last commit and how many were
+// made.
+func (i *Initializer) commitAll(ctx context.Context, repo *git.Repository, rs *runState, message string, files int) (plumbing.Hash, string, int, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, "", 0, err
+	}
+
+	groups := i.splitGroups(idx.Entries)
+	if len(groups) < 2 {
+		hash, err := i.commit(ctx, repo, message, rs)
+		if err != nil {
+			return plumbing.ZeroHash, "", 0, err
+		}
+		i.emit(Event{Type: Committed, Dir: rs.dir, Files: files, Commit: hash.String()})
+		return hash, message, 1, nil
+	}
+
+	var hash plumbing.Hash
+	var staged []*index.Entry
+	for n, g := range groups {
+		staged = append(staged, g.entries...)
+		sort.Slice(staged, func(a, b int) bool { return staged[a].Name < staged[b].Name })
+
+		idx.Entries = append([]*index.Entry(nil), staged...)
+		idx.Cache = nil
+		if err := repo.Storer.SetIndex(idx); err != nil {
+			return plumbing.ZeroHash, "", 0, err
+		}
+
+		if n > 0 {
+			message = i.groupMessage(g.label, rs)
+		}
+
+		hash, err = i.commit(ctx, repo, message, rs)
+		if err != nil {
+			return plumbing.ZeroHash, "", 0, err
+		}
+
+		i.logger.Info("committed group", "group", g.label, "files", len(g.entries), "commit", hash.String()[:shortHashLength])
+		i.emit(Event{Type: Committed, Dir: rs.dir, Files: len(g.entries), Commit: hash.String()})
+	}
+
+	return hash, message, len(groups), nil
+}
+
+// splitGroups divides entries as WithFirstCommit and WithSplitBy ask,
+// leaving out empty groups.
+func (i *Initializer) splitGroups(entries []*index.Entry) []commitGroup {
+	if len(i.firstCommit) == 0 {
+		return i.modeGroups(entries)
+	}
+
+	matcher := gitignore.NewMatcher(i.firstCommit)
+	var first, rest []*index.Entry
+	for _, e := range entries {
+		if matcher.Match(strings.Split(e.Name, "/"), false) {
+			first = append(first, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+
+	if len(first) == 0 {
+		i.logger.Debug("no files match the first commit patterns")
+		return i.modeGroups(rest)
+	}
+	groups := []commitGroup{{label: "first commit files", entries: first}}
+	if len(rest) > 0 {
+		groups = append(groups, i.modeGroups(rest)...)
+	}
+	return groups
+}
+
+// modeGroups divides entries as WithSplitBy asks. SplitNone gives a
+// single group.
+func (i *Initializer) modeGroups(entries []*index.Entry) []commitGroup {
+	if i.splitBy == SplitNone {
+		return []commitGroup{{label: "remaining files", entries: entries}}
+	}
+
+	byLabel := map[string][]*index.Entry{}
+	for _, e := range entries {
+		label := fileType(e.Name)
+		if i.splitBy == SplitByDir {
+			label = "top-level files"
+			if dir, _, ok := strings.Cut(e.Name, "/"); ok {
+				label = dir + "/"
+			}
+		}
+		byLabel[label] = append(byLabel[label], e)
+	}
+
+	labels := fileTypes
+	if i.splitBy == SplitByDir {
+		labels = make([]string, 0, len(byLabel))
+		for label := range byLabel {
+			if label != "top-level files" {
+				labels = append(labels, label)
+			}
+		}
+		sort.Strings(labels)
+		labels = append([]string{"top-level files"}, labels...)
+	}
+
+	var groups []commitGroup
+	for _, label := range labels {
+		if len(byLabel[label]) > 0 {
+			groups = append(groups, commitGroup{label: label, entries: byLabel[label]})
+		}
+	}
+	return groups
+}
@@ -0,0 +1,21 @@
+package greenleeks
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// fillStat copies the stat data git compares to notice changes into e, so
+// that git status does not need to rehash the file.
+func fillStat(e *index.Entry, info os.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		e.CreatedAt = time.Unix(st.Ctim.Unix())
+		e.Dev = uint32(st.Dev)
+		e.Inode = uint32(st.Ino)
+		e.UID = st.Uid
+		e.GID = st.Gid
+	}
+}
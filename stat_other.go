@@ -0,0 +1,13 @@
+//go:build !linux
+
+package greenleeks
+
+import (
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// fillStat leaves the entry with the modification time only. git status
+// rehashes such files once and then records their full stat data.
+func fillStat(e *index.Entry, info os.FileInfo) {}
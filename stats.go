@@ -0,0 +1,133 @@
+package greenleeks
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// ExtensionStats sums up the planned files with one extension.
+type ExtensionStats struct {
+	// Extension is lowercased and includes the dot, or is empty for
+	// files without one.
+	Extension string `json:"extension"`
+	Files     int    `json:"files"`
+	Size      int64  `json:"size"`
+}
+
+// ByExtension groups the planned files by extension, largest total size
+// first. Gitlinks are left out.
+func (p *Plan) ByExtension() []ExtensionStats {
+	index := map[string]int{}
+	var stats []ExtensionStats
+	for _, f := range p.Files {
+		if f.Gitlink {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(path.Base(f.Path)))
+		n, ok := index[ext]
+		if !ok {
+			n = len(stats)
+			index[ext] = n
+			stats = append(stats, ExtensionStats{Extension: ext})
+		}
+		stats[n].Files++
+		stats[n].Size += f.Size
+	}
+
+	slices.SortStableFunc(stats, func(a, b ExtensionStats) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Extension, b.Extension)
+	})
+	return stats
+}
+
+// Largest returns the n largest planned files, largest first.
+func (p *Plan) Largest(n int) []PlannedFile {
+	files := slices.Clone(p.Files)
+	slices.SortStableFunc(files, func(a, b PlannedFile) int {
+		return cmp.Compare(b.Size, a.Size)
+	})
+	return files[:min(n, len(files))]
+}
+
+// runStats prints what init would commit in --root broken down by
+// extension, with the largest files.
+func runStats() error {
+	options, err := cliOptions()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	plan, err := New(options...).Plan(ctx, opts.RootDir)
+	if err != nil {
+		return err
+	}
+
+	if opts.LogFormat == "json" {
+		type file struct {
+			Path string `json:"path"`
+			Size int64  `json:"size"`
+		}
+		largest := []file{}
+		for _, f := range plan.Largest(opts.Stats.Largest) {
+			largest = append(largest, file{f.Path, f.Size})
+		}
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Files      int              `json:"files"`
+			Size       int64            `json:"size"`
+			Extensions []ExtensionStats `json:"extensions"`
+			Largest    []file           `json:"largest"`
+		}{len(plan.Files), plan.TotalSize(), plan.ByExtension(), largest})
+	}
+
+	printStats(os.Stdout, plan, opts.Stats.Largest)
+	return nil
+}
+
+func printStats(out io.Writer, plan *Plan, largest int) {
+	total := plan.TotalSize()
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, s := range plan.ByExtension() {
+		ext := s.Extension
+		if ext == "" {
+			ext = "(none)"
+		}
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(s.Size) / float64(total)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%.1f%%\t  %s\n", s.Files, formatSize(s.Size), share, ext)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\n%d files, %s\n", len(plan.Files), formatSize(total))
+	printLargest(out, plan, largest)
+}
+
+// printLargest lists the n largest planned files, if there are any.
+func printLargest(out io.Writer, plan *Plan, n int) {
+	files := plan.Largest(n)
+	if len(files) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "\nLargest files:\n")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, f := range files {
+		fmt.Fprintf(w, "%s\t  %s\n", formatSize(f.Size), f.Path)
+	}
+	w.Flush()
+}
@@ -0,0 +1,103 @@
+package greenleeks
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+)
+
+const (
+	statusUntracked = "untracked"
+	statusDirty     = "dirty"
+)
+
+// runStatus lists the subdirectories of the given parent, or of --root,
+// that are not repositories, and with --dirty also the repositories with
+// uncommitted changes. Hidden directories are skipped.
+func runStatus() error {
+	parent := opts.RootDir
+	switch len(opts.args) {
+	case 0:
+	case 1:
+		parent = opts.args[0]
+	default:
+		return fmt.Errorf("status takes at most one directory, got %d", len(opts.args))
+	}
+
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		dir := filepath.Join(parent, entry.Name())
+		state, err := directoryStatus(dir, opts.Status.Dirty)
+		if err != nil {
+			slog.Warn("failed to check directory", "dir", dir, "error", err)
+			continue
+		}
+
+		if state != "" {
+			printStatus(os.Stdout, state, dir)
+		}
+	}
+
+	return nil
+}
+
+// directoryStatus returns statusUntracked for a directory outside git,
+// statusDirty for a repository with uncommitted changes when checkDirty is
+// set, and "" otherwise.
+func directoryStatus(dir string, checkDirty bool) (string, error) {
+	isUnderGit, err := isUnderGitControl(osfs.New(dir))
+	if err != nil {
+		return "", err
+	}
+
+	if !isUnderGit {
+		return statusUntracked, nil
+	}
+
+	if !checkDirty {
+		return "", nil
+	}
+
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+	if err != nil {
+		return "", err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return "", err
+	}
+
+	if !status.IsClean() {
+		return statusDirty, nil
+	}
+
+	return "", nil
+}
+
+func printStatus(out io.Writer, state, dir string) {
+	color := colorYellow
+	if state == "adopted" || state == "initialized" {
+		color = colorGreen
+	}
+	fmt.Fprintf(out, "%s  %s\n", paint(color, fmt.Sprintf("%-9s", state)), dir)
+}
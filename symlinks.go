@@ -0,0 +1,292 @@
+package greenleeks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// SymlinkPolicy selects what WithSymlinks does with symbolic links.
+type SymlinkPolicy string
+
+const (
+	// SymlinksKeep commits links as links, as git add does.
+	SymlinksKeep SymlinkPolicy = "keep"
+	// SymlinksFollow commits what links point at: the contents of a linked
+	// file, everything below a linked directory. Links that dangle, loop
+	// back on themselves or lead out of the directory are left out.
+	SymlinksFollow SymlinkPolicy = "follow"
+	// SymlinksSkip leaves links out of the commit.
+	SymlinksSkip SymlinkPolicy = "skip"
+)
+
+// maxFollowDepth bounds how deep a followed directory is walked, which
+// catches loops that dirKey cannot see.
+const maxFollowDepth = 255
+
+// linkedFile is a file reached through a symlink, named by the path that
+// leads to it through the link.
+type linkedFile struct {
+	path string
+	info os.FileInfo
+}
+
+// linkWalk is what following a symlink turned up: the files it leads to
+// and, with forward slashes, the links that dangle, loop or lead out of
+// the directory and are left out.
+type linkWalk struct {
+	files   []linkedFile
+	leftOut []string
+}
+
+// applySymlinks replaces the staged symlinks according to WithSymlinks.
+// The files followed links lead to are classified into rs.binaries. It
+// returns, with forward slashes, what was left out: the links with
+// SymlinksSkip, those that could not be followed, and the binary files
+// they lead to with WithNoBinaries.
+func (i *Initializer) applySymlinks(ctx context.Context, repo *git.Repository, rs *runState) ([]string, error) {
+	if i.symlinks == SymlinksKeep {
+		return nil, nil
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	fs := worktree.Filesystem
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	matcher, err := i.linkMatcher(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	var links, skipped []string
+	var followed []linkedFile
+	kept := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if e.Mode != filemode.Symlink {
+			kept = append(kept, e)
+			continue
+		}
+
+		links = append(links, e.Name)
+		if i.symlinks == SymlinksSkip {
+			skipped = append(skipped, e.Name)
+			continue
+		}
+
+		walk, err := i.followLink(ctx, fs, filepath.FromSlash(e.Name), matcher)
+		if err != nil {
+			return nil, err
+		}
+		followed = append(followed, walk.files...)
+		skipped = append(skipped, walk.leftOut...)
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+	idx.Entries = kept
+
+	var droppedBinaries []string
+	for _, f := range followed {
+		binary, err := isBinaryFile(fs, f.path)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.ToSlash(f.path)
+		if binary && i.noBinaries {
+			droppedBinaries = append(droppedBinaries, name)
+			skipped = append(skipped, name)
+			continue
+		}
+		if binary {
+			rs.binaries[name] = true
+		}
+
+		e, err := indexEntry(fs, repo, f.path, f.info)
+		if err != nil {
+			return nil, err
+		}
+		idx.Entries = append(idx.Entries, e)
+	}
+
+	if err := i.checkFileLimit(len(idx.Entries)); err != nil {
+		return nil, err
+	}
+
+	if len(droppedBinaries) > 0 {
+		i.logger.Info("Left out binary files.", "files", len(droppedBinaries), "examples", logExamples(droppedBinaries))
+	}
+
+	sort.Slice(idx.Entries, func(a, b int) bool { return idx.Entries[a].Name < idx.Entries[b].Name })
+
+	if i.symlinks == SymlinksSkip {
+		i.logger.Info("Left out symlinks.", "links", len(links), "examples", logExamples(links))
+	} else {
+		i.logger.Info("Followed symlinks.", "links", len(links), "files", len(followed), "examples", logExamples(links))
+	}
+	err = repo.Storer.SetIndex(idx)
+	if err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// linkMatcher matches what git add would leave out below a followed
+// directory: the top-level .gitignore rules and WithExcludes.
+func (i *Initializer) linkMatcher(fs billy.Filesystem) (gitignore.Matcher, error) {
+	patterns, err := gitignore.ReadPatterns(fs, nil)
+	if err != nil {
+		return nil, err
+	}
+	return gitignore.NewMatcher(append(patterns, i.excludePatterns()...)), nil
+}
+
+// followLink resolves the symlink name into the files it stands for.
+func (i *Initializer) followLink(ctx context.Context, fs billy.Filesystem, name string, matcher gitignore.Matcher) (*linkWalk, error) {
+	// A link to one of its own parents is a loop from the start.
+	var chain []string
+	for dir := filepath.Dir(name); ; dir = filepath.Dir(dir) {
+		if dir == "." {
+			dir = ""
+		}
+		key, err := i.dirKey(fs, dir)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, key)
+		if dir == "" {
+			break
+		}
+	}
+
+	walk := &linkWalk{}
+	err := i.walkLink(ctx, fs, name, matcher, chain, walk)
+	if err != nil {
+		return nil, err
+	}
+	return walk, nil
+}
+
+// walkLink adds name, or everything below it if it is a directory, to
+// walk. chain holds the directories name is reached through, so that a
+// link back to any of them is caught instead of walked forever.
+func (i *Initializer) walkLink(ctx context.Context, fs billy.Filesystem, name string, matcher gitignore.Matcher, chain []string, walk *linkWalk) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	info, err := fs.Stat(name)
+	switch {
+	case os.IsNotExist(err):
+		i.logger.Warn("leaving out dangling symlink", "path", filepath.ToSlash(name))
+		walk.leftOut = append(walk.leftOut, filepath.ToSlash(name))
+		return nil
+	case errors.Is(err, billy.ErrCrossedBoundary):
+		i.logger.Warn("leaving out symlink to outside the directory", "path", filepath.ToSlash(name))
+		walk.leftOut = append(walk.leftOut, filepath.ToSlash(name))
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if !info.IsDir() {
+		if info.Mode().IsRegular() {
+			walk.files = append(walk.files, linkedFile{path: name, info: info})
+		}
+		return nil
+	}
+
+	key, err := i.dirKey(fs, name)
+	if err != nil {
+		return err
+	}
+	for _, dir := range chain {
+		if dir == key || len(chain) > maxFollowDepth {
+			i.logger.Warn("leaving out symlink loop", "path", filepath.ToSlash(name))
+			walk.leftOut = append(walk.leftOut, filepath.ToSlash(name))
+			return nil
+		}
+	}
+	chain = append(chain[:len(chain):len(chain)], key)
+
+	entries, err := fs.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(name, e.Name())
+		if e.IsDir() && e.Name() == git.GitDirName {
+			continue
+		}
+		if matcher.Match(strings.Split(path, string(filepath.Separator)), e.IsDir()) {
+			continue
+		}
+		err := i.walkLink(ctx, fs, path, matcher, chain, walk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirKey identifies the directory name in fs by its path with all
+// symlinks resolved, so that two routes to the same directory compare
+// equal. Paths on a WithFilesystem filesystem have no real path to resolve
+// and are taken as they are, leaving loops there to maxFollowDepth.
+func (i *Initializer) dirKey(fs billy.Filesystem, name string) (string, error) {
+	if i.fs != nil {
+		return filepath.Join(fs.Root(), name), nil
+	}
+	return filepath.EvalSymlinks(filepath.Join(fs.Root(), name))
+}
+
+// plannedSymlinks applies WithSymlinks to the planned files.
+func (i *Initializer) plannedSymlinks(ctx context.Context, fs billy.Filesystem, files []PlannedFile) ([]PlannedFile, error) {
+	if i.symlinks == SymlinksKeep {
+		return files, nil
+	}
+
+	matcher, err := i.linkMatcher(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	var planned []PlannedFile
+	for _, f := range files {
+		name := filepath.FromSlash(f.Path)
+		info, err := fs.Lstat(name)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			planned = append(planned, f)
+			continue
+		}
+		if i.symlinks == SymlinksSkip {
+			continue
+		}
+
+		linked, err := i.followLink(ctx, fs, name, matcher)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range linked.files {
+			planned = append(planned, PlannedFile{Path: filepath.ToSlash(l.path), Size: l.info.Size()})
+		}
+	}
+	return planned, nil
+}
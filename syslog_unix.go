@@ -0,0 +1,45 @@
+//go:build !windows
+
+package greenleeks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+// syslogWriter sends the records a slog.TextHandler writes to the local
+// syslog, which journald reads on systemd machines, with a priority
+// matching their level.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func openSyslog() (io.Writer, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, programName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %v", err)
+	}
+	return syslogWriter{w: w}, nil
+}
+
+func (s syslogWriter) Write(p []byte) (int, error) {
+	line := string(bytes.TrimSuffix(p, []byte("\n")))
+
+	var err error
+	switch {
+	case bytes.HasPrefix(p, []byte("level=ERROR")):
+		err = s.w.Err(line)
+	case bytes.HasPrefix(p, []byte("level=WARN")):
+		err = s.w.Warning(line)
+	case bytes.HasPrefix(p, []byte("level=DEBUG")):
+		err = s.w.Debug(line)
+	default:
+		err = s.w.Info(line)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package greenleeks
+
+import (
+	"errors"
+	"io"
+)
+
+func openSyslog() (io.Writer, error) {
+	return nil, errors.New("--log-format syslog is not available on Windows")
+}
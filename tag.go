@@ -0,0 +1,39 @@
+package greenleeks
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// createTag tags the initial commit as configured by WithTag: annotated,
+// with the committer as tagger, when there is a tag message, lightweight
+// otherwise.
+func (i *Initializer) createTag(repo *git.Repository, hash plumbing.Hash, rs *runState) error {
+	if i.tag == "" {
+		return nil
+	}
+
+	var opts *git.CreateTagOptions
+	if i.tagMessage != "" {
+		opts = &git.CreateTagOptions{
+			Tagger: &object.Signature{
+				Name:  rs.committer.Name,
+				Email: rs.committer.Email,
+				When:  rs.committerDate,
+			},
+			Message: i.tagMessage,
+		}
+	}
+
+	_, err := repo.CreateTag(i.tag, hash, opts)
+	if err != nil {
+		return fmt.Errorf("failed to create tag %s: %v", i.tag, err)
+	}
+
+	i.logger.Info("tagged initial commit", "tag", i.tag, "annotated", opts != nil)
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package greenleeks
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	mymazda "github.com/taylormonacelli/forestfish/mymazda"
+)
+
+const gitConfigInitSection = "init"
+
+// templateDir picks the git template directory the way git init does:
+// WithTemplateDir, then GIT_TEMPLATE_DIR, then init.templateDir. Unlike
+// git there is no compiled-in default, so "" means no template.
+func (i *Initializer) templateDir(config *gitConfig) (string, error) {
+	dir := i.template
+	if dir == "" {
+		dir = os.Getenv("GIT_TEMPLATE_DIR")
+	}
+	if dir == "" {
+		dir = config.get(gitConfigInitSection, "", "templatedir")
+	}
+	if dir == "" {
+		return "", nil
+	}
+	return mymazda.ExpandTilde(dir)
+}
+
+// copyTemplate copies the template directory into the new repository's
+// git directory dot, keeping file modes so hooks stay executable. Files
+// go-git already created, such as config and HEAD, are not overwritten.
+func (i *Initializer) copyTemplate(dot billy.Filesystem, templateDir string) error {
+	src := osfs.New(templateDir)
+
+	var copied []string
+	err := util.Walk(src, "", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return nil
+		}
+		if info.IsDir() {
+			return dot.MkdirAll(path, info.Mode().Perm()|0o700)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if _, err := dot.Lstat(path); err == nil {
+			return nil
+		}
+
+		copied = append(copied, filepath.ToSlash(path))
+		return copyFile(src, dot, path, info.Mode().Perm())
+	})
+	if len(copied) > 0 {
+		i.logger.Debug("copied template files", "files", len(copied), "examples", logExamples(copied))
+	}
+	return err
+}
+
+func copyFile(src, dst billy.Filesystem, path string, perm os.FileMode) error {
+	in, err := src.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := dst.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
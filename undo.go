@@ -0,0 +1,201 @@
+package greenleeks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// markerSection is the section of the repository config in which Run
+// records what it created, for Undo to check against.
+const markerSection = "greenleeks"
+
+// recordCreation marks repo as created by Run, with commit as its last
+// commit, and adds tag, if any, to the tags it made.
+func recordCreation(repo *git.Repository, commit plumbing.Hash, tag string) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+
+	section := cfg.Raw.Section(markerSection)
+	section.SetOption("commit", commit.String())
+	if tag != "" && !slices.Contains(section.OptionAll("tag"), tag) {
+		section.AddOption("tag", tag)
+	}
+	return repo.Storer.SetConfig(cfg)
+}
+
+// Undo removes the repository Run created in dir, leaving the files in
+// dir alone. It refuses, with ErrNotUndoable, unless the repository holds
+// nothing but what Run committed: no further commits, branches or tags.
+// Bare repositories and WithDotfiles setups are not handled.
+func (i *Initializer) Undo(ctx context.Context, dir string) error {
+	fs, err := i.filesystem(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+
+	info, err := fs.Lstat(git.GitDirName)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s has no .git", ErrNotUndoable, dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	dot, remove, err := undoTarget(fs, info.IsDir())
+	if err != nil {
+		return err
+	}
+
+	repo, err := git.Open(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), fs)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err = checkPristine(repo)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotUndoable, err)
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return err
+	}
+	for _, r := range remotes {
+		i.logger.Warn("the remote repository is left as it is", "remote", r.Config().Name, "url", r.Config().URLs)
+	}
+
+	err = remove()
+	if err != nil {
+		return fmt.Errorf("failed to remove repository: %w", err)
+	}
+
+	i.logger.Info("Removed the repository.", "gitdir", dot.Root())
+	return nil
+}
+
+// undoTarget returns the git directory of the work tree fs and a function
+// removing it, along with a .git file pointing at it.
+func undoTarget(fs billy.Filesystem, isDir bool) (billy.Filesystem, func() error, error) {
+	if isDir {
+		dot, err := fs.Chroot(git.GitDirName)
+		if err != nil {
+			return nil, nil, err
+		}
+		return dot, func() error { return util.RemoveAll(fs, git.GitDirName) }, nil
+	}
+
+	content, err := readFile(fs, git.GitDirName)
+	if err != nil {
+		return nil, nil, err
+	}
+	gitdir, ok := strings.CutPrefix(string(bytes.TrimSpace(content)), "gitdir: ")
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: .git is not a gitdir file", ErrNotUndoable)
+	}
+	if !filepath.IsAbs(gitdir) {
+		gitdir = filepath.Join(fs.Root(), gitdir)
+	}
+
+	// A linked worktree shares its repository with others.
+	if _, err := os.Stat(filepath.Join(gitdir, "commondir")); err == nil {
+		return nil, nil, fmt.Errorf("%w: %s is a linked worktree", ErrNotUndoable, fs.Root())
+	}
+
+	remove := func() error {
+		if err := os.RemoveAll(gitdir); err != nil {
+			return err
+		}
+		return fs.Remove(git.GitDirName)
+	}
+	return osfs.New(gitdir), remove, nil
+}
+
+// checkPristine fails unless repo was created by Run and every branch and
+// tag is still where Run left it.
+func checkPristine(repo *git.Repository) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+
+	section := cfg.Raw.Section(markerSection)
+	commit := section.Option("commit")
+	if commit == "" {
+		return errors.New("it was not created by greenleeks")
+	}
+	tags := section.OptionAll("tag")
+
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	if head.Hash().String() != commit {
+		return errors.New("HEAD has moved on from the initial commit")
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return err
+	}
+	defer refs.Close()
+
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		switch {
+		case name == plumbing.HEAD, name.IsRemote():
+			return nil
+		case name.IsBranch():
+			if ref.Hash().String() != commit {
+				return fmt.Errorf("branch %s has commits of its own", name.Short())
+			}
+			return nil
+		case name.IsTag() && slices.Contains(tags, name.Short()):
+			return nil
+		default:
+			return fmt.Errorf("%s was added since", name)
+		}
+	})
+}
+
+// runUndo removes the repository init created in the given directory, or
+// in --root.
+func runUndo() error {
+	dir := opts.RootDir
+	switch len(opts.args) {
+	case 0:
+	case 1:
+		dir = opts.args[0]
+	default:
+		return fmt.Errorf("undo takes at most one directory, got %d", len(opts.args))
+	}
+
+	options, err := cliOptions()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	return New(options...).Undo(ctx, dir)
+}
@@ -0,0 +1,88 @@
+package greenleeks
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set at link time with
+//
+//	-ldflags "-X github.com/taylormonacelli/greenleeks.buildVersion=v1.2.3 ..."
+//
+// Anything left empty is filled in from the module build info.
+var (
+	buildVersion string
+	buildCommit  string
+	buildDate    string
+)
+
+// BuildInfo identifies the binary.
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	Date      string
+	Modified  bool
+	GoVersion string
+}
+
+// ReadBuildInfo returns the link-time metadata, falling back to what the
+// go command recorded in the binary.
+func ReadBuildInfo() BuildInfo {
+	bi := BuildInfo{
+		Version:   buildVersion,
+		Commit:    buildCommit,
+		Date:      buildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+
+	if bi.Version == "" {
+		bi.Version = info.Main.Version
+	}
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if bi.Commit == "" {
+				bi.Commit = s.Value
+			}
+		case "vcs.time":
+			if bi.Date == "" {
+				bi.Date = s.Value
+			}
+		case "vcs.modified":
+			bi.Modified = s.Value == "true"
+		}
+	}
+
+	return bi
+}
+
+func printVersion() error {
+	bi := ReadBuildInfo()
+
+	v := bi.Version
+	if v == "" {
+		v = "(devel)"
+	}
+	fmt.Printf("%s %s\n", programName, v)
+
+	if bi.Commit != "" {
+		c := bi.Commit
+		if bi.Modified {
+			c += " (modified)"
+		}
+		fmt.Printf("commit: %s\n", c)
+	}
+	if bi.Date != "" {
+		fmt.Printf("built:  %s\n", bi.Date)
+	}
+	fmt.Printf("go:     %s\n", bi.GoVersion)
+
+	return nil
+}
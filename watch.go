@@ -0,0 +1,236 @@
+package greenleeks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// runWatch initializes each directory created in the given parent, or in
+// --root, once nothing has been written to it for --settle. Directories
+// that exist when it starts, and hidden ones, are left alone. With --every
+// it sweeps the parent at that interval instead. It runs until
+// interrupted, and only once per parent.
+func runWatch() error {
+	parent := opts.RootDir
+	switch len(opts.args) {
+	case 0:
+	case 1:
+		parent = opts.args[0]
+	default:
+		return fmt.Errorf("watch takes at most one directory, got %d", len(opts.args))
+	}
+
+	if opts.Watch.Settle <= 0 {
+		return fmt.Errorf("--settle must be positive, got %s", opts.Watch.Settle)
+	}
+
+	options, err := cliOptions()
+	if err != nil {
+		return err
+	}
+	i := New(options...)
+
+	unlock, err := lockWatch(parent, opts.Watch.Takeover)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if opts.Watch.Every > 0 {
+		ctx, stop := interruptContext()
+		defer stop()
+		return sweepEvery(ctx, i, parent)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	err = watcher.Add(parent)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", parent, err)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	slog.Info("Watching for new directories.", "dir", parent, "settle", opts.Watch.Settle)
+
+	// pending holds a timer for each new directory that has not settled
+	// yet; a timer that fires sends the directory on settled. empty holds
+	// the directories that had nothing to commit when they settled, which
+	// stay watched until something is written into them.
+	pending := map[string]*time.Timer{}
+	empty := map[string]bool{}
+	settled := make(chan string)
+	settle := func(dir string) {
+		if t, ok := pending[dir]; ok {
+			t.Reset(opts.Watch.Settle)
+			return
+		}
+		pending[dir] = time.AfterFunc(opts.Watch.Settle, func() {
+			select {
+			case settled <- dir:
+			case <-ctx.Done():
+			}
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, t := range pending {
+				t.Stop()
+			}
+			return watchEnded(ctx)
+
+		case err := <-watcher.Errors:
+			slog.Warn("watching failed to keep up", "error", err)
+
+		case ev := <-watcher.Events:
+			dir := filepath.Dir(ev.Name)
+			if _, ok := pending[dir]; ok || empty[dir] {
+				// Something was written into a new directory.
+				delete(empty, dir)
+				settle(dir)
+				continue
+			}
+			if dir != filepath.Clean(parent) || strings.HasPrefix(filepath.Base(ev.Name), ".") {
+				continue
+			}
+
+			switch {
+			case ev.Has(fsnotify.Create):
+				info, err := os.Lstat(ev.Name)
+				if err != nil || !info.IsDir() {
+					continue
+				}
+				// Watch the directory itself too, so that files still
+				// being written into it hold off the run.
+				if err := watcher.Add(ev.Name); err != nil {
+					slog.Warn("failed to watch directory", "dir", ev.Name, "error", err)
+				}
+				slog.Debug("new directory", "dir", ev.Name)
+				settle(ev.Name)
+			case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+				if t, ok := pending[ev.Name]; ok {
+					t.Stop()
+					delete(pending, ev.Name)
+				}
+				delete(empty, ev.Name)
+			}
+
+		case dir := <-settled:
+			delete(pending, dir)
+			if initSubdir(ctx, i, dir) {
+				empty[dir] = true
+				continue
+			}
+			_ = watcher.Remove(dir)
+		}
+	}
+}
+
+// sweepEvery initializes the subdirectories of parent that are not
+// repositories, hidden ones apart, and again every --every, for
+// filesystems that do not report changes, like NFS. A directory modified
+// within --settle waits for the next sweep.
+func sweepEvery(ctx context.Context, i *Initializer, parent string) error {
+	slog.Info("Sweeping for new directories.", "dir", parent, "every", opts.Watch.Every)
+
+	ticker := time.NewTicker(opts.Watch.Every)
+	defer ticker.Stop()
+
+	for {
+		sweep(ctx, i, parent)
+
+		select {
+		case <-ctx.Done():
+			return watchEnded(ctx)
+		case <-ticker.C:
+		}
+	}
+}
+
+func sweep(ctx context.Context, i *Initializer, parent string) {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		slog.Warn("failed to read directory", "dir", parent, "error", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		dir := filepath.Join(parent, entry.Name())
+		state, err := directoryStatus(dir, false)
+		if err != nil {
+			slog.Warn("failed to check directory", "dir", dir, "error", err)
+			continue
+		}
+		if state != statusUntracked {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) < opts.Watch.Settle {
+			slog.Debug("directory has not settled yet", "dir", dir)
+			continue
+		}
+
+		initSubdir(ctx, i, dir)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// watchEnded is what watch returns once ctx is done: nothing for an
+// interrupt, the error for --timeout.
+func watchEnded(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// initSubdir runs i on dir for watch, reporting the outcome instead of
+// returning it, so that one directory failing does not stop the others.
+// It reports whether dir had nothing to commit yet, and is worth another
+// try once something is written into it.
+func initSubdir(ctx context.Context, i *Initializer, dir string) bool {
+	result, err := i.Run(ctx, dir)
+	recordRun(result, err)
+
+	switch {
+	case errors.Is(err, ErrAlreadyUnderGit):
+		slog.Debug("directory is already under git control", "dir", dir)
+	case errors.Is(err, ErrInProgress):
+		slog.Info("Another run is initializing the directory.", "dir", dir)
+	case errors.Is(err, ErrNothingToCommit):
+		// An empty directory is picked up again by the next sweep, or the
+		// next write into it.
+		slog.Info("Nothing to commit in the directory yet.", "dir", dir)
+		return true
+	case err != nil:
+		slog.Error("failed to initialize directory", "dir", dir, "error", err)
+	case !opts.Quiet:
+		printStatus(os.Stdout, "initialized", fmt.Sprintf("%s  %s", dir, result.ShortHash()))
+	}
+	return false
+}